@@ -0,0 +1,370 @@
+package dbq
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// CacheStats reports the effectiveness of the template cache.
+type CacheStats struct {
+	Hits     uint64 // compilations served from the cache
+	Misses   uint64 // compilations that had to serialize the expression
+	Bypasses uint64 // compilations that could not use the cache, because the dialect or the expression could not be fingerprinted
+	Size     int    // the number of templates in the cache
+}
+
+/*
+SetCacheSize enables caching of compiled templates in *Dbq.SQL(), and therefore in Into() and friends, if the dialect is a Compiler. Up to n templates are kept; the least recently used one is evicted when the cache is full.
+A size of 0 disables the cache, which is the default.
+
+Templates are looked up by a fingerprint of the entire expression tree, combined with the shape of the Args (see Template).
+Literals that are passed in implicit placeholders, such as strings, only contribute their type, so expressions that differ only in those values share a template; the values are collected from the tree whenever the template is used.
+Computing the fingerprint still walks the tree, but avoids the dialect's serialization work. Expressions are assumed to serialize the same way whenever their contents are equal; custom Nodes that depend on outside state should not be used with the cache.
+Expressions containing maps, functions or channels are never cached.
+*/
+func (q *Dbq) SetCacheSize(n int) *Dbq {
+	if n <= 0 {
+		q.cache = nil
+	} else {
+		q.cache = &templateCache{size: n, entries: make(map[[16]byte]*list.Element), lru: list.New()}
+	}
+	return q
+}
+
+// CacheStats returns the current statistics of the template cache, or zeroes if the cache is disabled.
+func (q *Dbq) CacheStats() CacheStats {
+	if q.cache == nil {
+		return CacheStats{}
+	}
+	return q.cache.stats()
+}
+
+// compile returns the template for e and v from the cache c, compiling it with d and storing it if necessary.
+func (q *Dbq) compile(c *templateCache, d Compiler, e Expression, v Args) (*Template, error) {
+	key, ok := fingerprint(q.Dialect, e, argsShape(v))
+	if !ok {
+		c.count(&c.bypasses)
+		return d.Compile(e, v)
+	}
+	if entry, ok := c.get(key); ok {
+		if t, ok := entry.apply(staticValues(e)); ok {
+			c.count(&c.hits)
+			return t, nil
+		}
+	}
+	c.count(&c.misses)
+	t, err := d.Compile(e, v)
+	if err != nil {
+		return nil, err
+	}
+	if positions, ok := staticPositions(t, staticValues(e)); ok {
+		c.put(&cacheEntry{key: key, t: t, statics: positions})
+	}
+	return t, nil
+}
+
+// staticValues returns the values of the literals in e that are passed in implicit placeholders, in the order of Walk().
+func staticValues(e Expression) (values []interface{}) {
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		if list, ok := value.([]interface{}); ok {
+			for _, element := range list {
+				collect(element)
+			}
+			return
+		}
+		values = append(values, value)
+	}
+	Walk(e, func(n Node) bool {
+		switch n := n.(type) {
+		case LiteralString:
+			collect(string(n))
+		case LiteralList:
+			collect([]interface{}(n))
+		case LiteralValue:
+			collect(n.Value)
+		}
+		return true
+	})
+	return
+}
+
+// staticPositions finds the position in t.Values of each of the statics, which were collected from the expression that t was compiled from.
+// Serialization may not follow the order of Walk(), so the values are matched by their fingerprints; it returns false if that is ambiguous, e.g. because a value occurs twice, or if t has placeholders that are not among the statics.
+func staticPositions(t *Template, statics []interface{}) ([]int, bool) {
+	index := make(map[[16]byte]int, len(statics))
+	for i, value := range statics {
+		key, ok := fingerprintValue(value)
+		if !ok {
+			return nil, false
+		}
+		if _, dup := index[key]; dup {
+			return nil, false
+		}
+		index[key] = i
+	}
+	bound := make(map[int]bool)
+	for _, indexes := range t.Bindings {
+		for _, i := range indexes {
+			bound[i] = true
+		}
+	}
+	positions := make([]int, len(statics))
+	found := 0
+	for i, value := range t.Values {
+		if bound[i] {
+			continue
+		}
+		key, ok := fingerprintValue(value)
+		if !ok {
+			return nil, false
+		}
+		j, ok := index[key]
+		if !ok {
+			return nil, false
+		}
+		delete(index, key)
+		positions[j] = i
+		found++
+	}
+	return positions, found == len(statics)
+}
+
+type templateCache struct {
+	sync.Mutex
+	size         int
+	entries      map[[16]byte]*list.Element
+	lru          *list.List // of *cacheEntry, most recently used first
+	hits, misses uint64
+	bypasses     uint64
+}
+
+type cacheEntry struct {
+	key     [16]byte
+	t       *Template
+	statics []int // the position in t.Values of each value returned by staticValues()
+}
+
+// apply returns the template with the static values of another expression of the same fingerprint.
+func (entry *cacheEntry) apply(statics []interface{}) (*Template, bool) {
+	if len(statics) != len(entry.statics) {
+		return nil, false
+	}
+	t := *entry.t
+	t.Values = make([]interface{}, len(entry.t.Values))
+	copy(t.Values, entry.t.Values)
+	for i, position := range entry.statics {
+		t.Values[position] = statics[i]
+	}
+	return &t, true
+}
+
+func (c *templateCache) get(key [16]byte) (*cacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry), true
+}
+
+// count increments one of the statistics of c.
+func (c *templateCache) count(stat *uint64) {
+	c.Lock()
+	defer c.Unlock()
+	*stat++
+}
+
+func (c *templateCache) put(entry *cacheEntry) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[entry.key]; ok {
+		// compiled concurrently by another caller
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *templateCache) stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Bypasses: c.bypasses, Size: c.lru.Len()}
+}
+
+var (
+	dbqPtrType        = reflect.TypeOf((*Dbq)(nil))
+	selectQueryType   = reflect.TypeOf(SelectQuery{})
+	literalStringType = reflect.TypeOf(LiteralString(""))
+	literalListType   = reflect.TypeOf(LiteralList(nil))
+	literalValueType  = reflect.TypeOf(LiteralValue{})
+	interfaceListType = reflect.TypeOf([]interface{}(nil))
+)
+
+// fingerprint hashes the dialect, the expression tree and the Args shape. It returns false if the tree contains values that cannot be hashed.
+func fingerprint(d Dialect, e Expression, shape string) (key [16]byte, ok bool) {
+	f := &fingerprinter{h: fnv.New128a(), seen: make(map[visit]int)}
+	if !f.value(reflect.ValueOf(&d).Elem()) || !f.value(reflect.ValueOf(&e).Elem()) {
+		return key, false
+	}
+	f.string(shape)
+	copy(key[:], f.h.Sum(nil))
+	return key, true
+}
+
+// fingerprintValue hashes a single value.
+func fingerprintValue(value interface{}) (key [16]byte, ok bool) {
+	f := &fingerprinter{h: fnv.New128a(), seen: make(map[visit]int)}
+	if !f.value(reflect.ValueOf(&value).Elem()) {
+		return key, false
+	}
+	copy(key[:], f.h.Sum(nil))
+	return key, true
+}
+
+type fingerprinter struct {
+	h    hash.Hash
+	seen map[visit]int // pointers already visited, numbered in visiting order
+	buf  [8]byte
+}
+
+type visit struct {
+	t reflect.Type
+	p uintptr
+}
+
+func (f *fingerprinter) uint(u uint64) {
+	binary.LittleEndian.PutUint64(f.buf[:], u)
+	f.h.Write(f.buf[:])
+}
+
+func (f *fingerprinter) string(s string) {
+	f.uint(uint64(len(s)))
+	f.h.Write([]byte(s))
+}
+
+func (f *fingerprinter) typ(t reflect.Type) {
+	f.string(t.PkgPath())
+	f.string(t.String())
+}
+
+// static hashes the value of a literal that is passed in implicit placeholders: lists by their length, and everything else by type only.
+func (f *fingerprinter) static(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			f.uint(0)
+			return true
+		}
+		v = v.Elem()
+	}
+	f.uint(2)
+	f.typ(v.Type())
+	if v.Type() == interfaceListType || v.Type() == literalListType {
+		f.uint(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if !f.static(v.Index(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// value hashes v, following pointers and interfaces. Unexported fields are read, but never converted back to interface{}.
+func (f *fingerprinter) value(v reflect.Value) bool {
+	switch v.Type() {
+	case literalStringType, literalListType:
+		return f.static(v)
+	case literalValueType:
+		return f.static(v.Field(0))
+	case selectQueryType:
+		// the scan mode and key of a query do not affect serialization
+		return f.value(v.FieldByName("Expr"))
+	}
+	f.uint(uint64(v.Kind()))
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			f.uint(1)
+		} else {
+			f.uint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.uint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f.uint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f.uint(math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		f.uint(math.Float64bits(real(v.Complex())))
+		f.uint(math.Float64bits(imag(v.Complex())))
+	case reflect.String:
+		f.string(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			f.uint(0)
+			return true
+		}
+		f.uint(uint64(v.Len()) + 1)
+		for i := 0; i < v.Len(); i++ {
+			if !f.value(v.Index(i)) {
+				return false
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !f.value(v.Index(i)) {
+				return false
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !f.value(v.Field(i)) {
+				return false
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			f.uint(0)
+			return true
+		}
+		if v.Type() == dbqPtrType {
+			// queries refer back to their *Dbq, which does not affect serialization
+			f.uint(1)
+			return true
+		}
+		// shared nodes refer to their first occurrence; this also terminates cycles
+		ptr := visit{v.Type(), v.Pointer()}
+		if n, ok := f.seen[ptr]; ok {
+			f.uint(2)
+			f.uint(uint64(n))
+			return true
+		}
+		f.seen[ptr] = len(f.seen)
+		f.uint(3)
+		return f.value(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			f.uint(0)
+			return true
+		}
+		f.uint(1)
+		f.typ(v.Elem().Type())
+		return f.value(v.Elem())
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package dbq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability is a set of optional SQL features that a dialect supports.
+type Capability int
+
+const (
+	CapReturning       Capability = 1 << iota // INSERT/UPDATE/DELETE ... RETURNING
+	CapOnConflict                             // INSERT ... ON CONFLICT
+	CapDistinctOn                             // SELECT DISTINCT ON (...)
+	CapFullJoin                               // FULL OUTER JOIN
+	CapILike                                  // case-insensitive ILIKE; emulated with LOWER() otherwise
+	CapDistinctFrom                           // IS [NOT] DISTINCT FROM; emulated with CASE otherwise
+	CapWindowFunctions                        // f(...) OVER (...)
+)
+
+var capabilityNames = []string{"RETURNING", "ON CONFLICT", "DISTINCT ON", "FULL JOIN", "ILIKE", "IS DISTINCT FROM", "window functions"}
+
+func (c Capability) String() string {
+	names := []string{}
+	for i, name := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Has reports whether all capabilities in other are in c.
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+// UnsupportedFeatureError is returned when serializing a query that uses a feature the dialect does not have and dbq cannot emulate.
+type UnsupportedFeatureError struct {
+	Feature Capability
+}
+
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("%v is not supported by this dialect", e.Feature)
+}
+
+// require returns an *UnsupportedFeatureError if the syntax of c lacks feature.
+func (c *BaseCtx) require(feature Capability) error {
+	if !c.Syntax.Capabilities().Has(feature) {
+		return &UnsupportedFeatureError{Feature: feature}
+	}
+	return nil
+}
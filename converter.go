@@ -0,0 +1,183 @@
+package dbq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+/*
+Converter translates values of a Go type to and from database values, for types that do not implement driver.Valuer and sql.Scanner themselves.
+
+Converters are registered on a *Dbq with RegisterConverter() and apply to values bound in literals, Args and Bind(), and to scan targets in Into() and friends.
+*/
+type Converter interface {
+	// Value converts a value of the registered type to one that can be passed to the driver.
+	Value(v interface{}) (driver.Value, error)
+	// Scan stores a value returned by the driver in dest, which is a pointer to the registered type.
+	// src is nil for NULLs.
+	Scan(src interface{}, dest interface{}) error
+}
+
+// ConverterFuncs adapts a pair of functions to the Converter interface.
+type ConverterFuncs struct {
+	ValueFunc func(v interface{}) (driver.Value, error)
+	ScanFunc  func(src interface{}, dest interface{}) error
+}
+
+func (c ConverterFuncs) Value(v interface{}) (driver.Value, error)    { return c.ValueFunc(v) }
+func (c ConverterFuncs) Scan(src interface{}, dest interface{}) error { return c.ScanFunc(src, dest) }
+
+// converterRegistry holds the converters of a *Dbq.
+// The map is never modified after publication, so a snapshot can be read without locking.
+type converterRegistry struct {
+	sync.Mutex
+	types map[reflect.Type]Converter
+}
+
+func (r *converterRegistry) snapshot() map[reflect.Type]Converter {
+	r.Lock()
+	defer r.Unlock()
+	return r.types
+}
+
+/*
+RegisterConverter makes c responsible for values of the same type as sample:
+
+	q.RegisterConverter(Money{}, moneyConverter)
+
+Pointers to the registered type are handled too, with nil pointers corresponding to NULLs.
+*/
+func (q *Dbq) RegisterConverter(sample interface{}, c Converter) *Dbq {
+	q.converters.Lock()
+	types := make(map[reflect.Type]Converter, len(q.converters.types)+1)
+	for t, existing := range q.converters.types {
+		types[t] = existing
+	}
+	types[reflect.TypeOf(sample)] = c
+	q.converters.types = types
+	q.converters.Unlock()
+
+	// registered types become scalars, which changes how structs containing them are mapped
+	q.fields.Lock()
+	q.fields.types = nil
+	q.fields.Unlock()
+	return q
+}
+
+// SQL serializes an Expression using the dialect, like Dialect.SQL(), and converts the collected values with the registered converters.
+func (q *Dbq) SQL(e Expression, v Args) (sql string, values []interface{}, err error) {
+	if d, ok := q.Dialect.(Compiler); ok && q.cache != nil {
+		var t *Template
+		if t, err = q.compile(q.cache, d, e, v); err != nil {
+			return
+		}
+		sql, values = t.SQL, t.Bind(v)
+	} else {
+		sql, values, err = q.Dialect.SQL(e, v)
+		if err != nil {
+			return
+		}
+	}
+	if err = q.convertValues(values); err != nil {
+		return "", nil, err
+	}
+	return
+}
+
+// convertValues replaces the elements of values with their converted form, in place.
+// It fails for values that neither a converter nor the driver can handle.
+func (q *Dbq) convertValues(values []interface{}) (err error) {
+	converters := q.converters.snapshot()
+	for i, value := range values {
+		values[i], err = convertValue(converters, value)
+		if err != nil {
+			return
+		}
+		if err = checkDriverValue(values[i]); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkDriverValue returns an error if v is not a value that database/sql passes to drivers: a driver.Valuer, a basic type, or a pointer to one.
+func checkDriverValue(v interface{}) error {
+	if _, ok := v.(driver.Valuer); ok {
+		return nil
+	}
+	if _, err := driver.DefaultParameterConverter.ConvertValue(v); err != nil {
+		return fmt.Errorf("cannot bind %v [%T]: %v; register a Converter for the type", v, v, err)
+	}
+	return nil
+}
+
+func convertValue(converters map[reflect.Type]Converter, value interface{}) (interface{}, error) {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return nil, nil
+	}
+	if c, ok := converters[t]; ok {
+		return c.Value(value)
+	}
+	if t.Kind() == reflect.Ptr {
+		if c, ok := converters[t.Elem()]; ok {
+			v := reflect.ValueOf(value)
+			if v.IsNil() {
+				return nil, nil
+			}
+			return c.Value(v.Elem().Interface())
+		}
+	}
+	return value, nil
+}
+
+// convertingScanner is a scan destination that delegates to a Converter.
+type convertingScanner struct {
+	c        Converter
+	dest     reflect.Value // an addressable value of the registered type, or of a pointer to it
+	indirect bool          // whether dest is a pointer to the registered type
+}
+
+// convertingScannerFor returns a scan destination for dest if there is a converter registered for its type, or the type it points to.
+func convertingScannerFor(converters map[reflect.Type]Converter, dest reflect.Value) (*convertingScanner, bool) {
+	t := dest.Type()
+	if c, ok := converters[t]; ok {
+		return &convertingScanner{c: c, dest: dest}, true
+	}
+	if t.Kind() == reflect.Ptr {
+		if c, ok := converters[t.Elem()]; ok {
+			return &convertingScanner{c: c, dest: dest, indirect: true}, true
+		}
+	}
+	return nil, false
+}
+
+func (s *convertingScanner) Scan(src interface{}) error {
+	if !s.indirect {
+		return s.c.Scan(src, s.dest.Addr().Interface())
+	}
+	if src == nil {
+		s.dest.Set(reflect.Zero(s.dest.Type()))
+		return nil
+	}
+	target := reflect.New(s.dest.Type().Elem())
+	if err := s.c.Scan(src, target.Interface()); err != nil {
+		return err
+	}
+	s.dest.Set(target)
+	return nil
+}
+
+// hasConverter reports whether values of type t are handled by a converter.
+func hasConverter(converters map[reflect.Type]Converter, t reflect.Type) bool {
+	if _, ok := converters[t]; ok {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		_, ok := converters[t.Elem()]
+		return ok
+	}
+	return false
+}
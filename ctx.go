@@ -0,0 +1,764 @@
+package dbq
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+/*
+BaseCtx implements Ctx for any Syntax, and holds the state shared by all nodes of a query, such as the collected placeholder values.
+
+A dialect that only differs from an existing one in how it spells things can use a BaseCtx with its own Syntax, usually through SyntaxDialect.
+A dialect that needs to serialize some node differently can embed BaseCtx in its own Ctx, override the corresponding methods, and set Self to the outer Ctx, so that subexpressions are serialized with the overrides too:
+
+	type RedshiftCtx struct {
+		dbq.BaseCtx
+	}
+
+	func (c *RedshiftCtx) AggFunc(f *dbq.AggFuncExpr) (string, error) {
+		...
+		return c.BaseCtx.AggFunc(f)
+	}
+
+	c := &RedshiftCtx{dbq.BaseCtx{Syntax: dbq.PostgresSyntax{}}}
+	c.Self = c
+*/
+type BaseCtx struct {
+	Syntax Syntax
+	Self   Ctx  // the Ctx passed to subexpressions; the BaseCtx itself if nil
+	Pretty bool // whether to write each clause of a query on its own line, and indent subqueries
+
+	placeholderValues        []interface{}
+	placeholderNameToIndexes map[string][]int
+	dynamicValues            Args
+	referenced               map[string]bool // names of all bindings in the query
+	unbound                  []string        // names of bindings without a value in dynamicValues
+	checkBindings            bool            // whether to collect unbound names
+	inline                   bool            // whether to emit markers for Interpolate() instead of placeholders
+}
+
+// outer returns the Ctx to serialize subexpressions with.
+func (c *BaseCtx) outer() Ctx {
+	if c.Self != nil {
+		return c.Self
+	}
+	return c
+}
+
+func (c *BaseCtx) BindValue(b *Binding) (value interface{}, ok bool) {
+	value, ok = c.dynamicValues[b.name]
+	return
+}
+
+// operand serializes an operand of an operator, in parentheses if it is compound.
+func (c *BaseCtx) operand(e Expression) (sql string, err error) {
+	sql, err = e.String(c.outer())
+	if err != nil {
+		return
+	}
+	if e.IsCompound() {
+		sql = c.parens(sql)
+	}
+	return
+}
+
+// parens wraps sql in parentheses. A pretty-printed subquery goes on lines of its own, indented.
+func (c *BaseCtx) parens(sql string) string {
+	if c.Pretty && strings.Contains(sql, "\n") {
+		return "(\n" + prettyIndent + strings.Replace(sql, "\n", "\n"+prettyIndent, -1) + "\n)"
+	}
+	return "(" + sql + ")"
+}
+
+const prettyIndent = "  "
+
+func (c *BaseCtx) BinaryOp(e *BinaryOp) (sql string, err error) {
+	switch e.op {
+	case "ILIKE":
+		if !c.Syntax.Capabilities().Has(CapILike) {
+			return c.emulateILike(e)
+		}
+	case "IS DISTINCT FROM", "IS NOT DISTINCT FROM":
+		if !c.Syntax.Capabilities().Has(CapDistinctFrom) {
+			return c.emulateDistinctFrom(e)
+		}
+	}
+	a, err := c.operand(e.a)
+	if err != nil {
+		return
+	}
+	b, err := c.operand(e.b)
+	if err != nil {
+		return
+	}
+	if e.op == "=" || e.op == "!=" {
+		// compare with whichever side is not NULL; if both are, NULL IS NULL is as good as any
+		operand := ""
+		if isNull(c.outer(), e.b) {
+			operand = a
+		} else if isNull(c.outer(), e.a) {
+			operand = b
+		}
+		if operand != "" {
+			if e.op == "=" {
+				sql = operand + " IS NULL"
+			} else {
+				sql = operand + " IS NOT NULL"
+			}
+			return
+		}
+	}
+	sql = a + " " + e.op + " " + b
+	return
+}
+
+func (c *BaseCtx) emulateILike(e *BinaryOp) (sql string, err error) {
+	a, err := e.a.String(c.outer())
+	if err != nil {
+		return
+	}
+	b, err := e.b.String(c.outer())
+	if err != nil {
+		return
+	}
+	return "LOWER(" + a + ") LIKE LOWER(" + b + ")", nil
+}
+
+// emulateDistinctFrom spells out the NULL handling of IS [NOT] DISTINCT FROM.
+// Each operand occurs twice, so it is serialized twice, which gives positional placeholders their own values.
+func (c *BaseCtx) emulateDistinctFrom(e *BinaryOp) (sql string, err error) {
+	operands := make([]string, 4)
+	for i := range operands {
+		side := e.a
+		if i%2 == 1 {
+			side = e.b
+		}
+		if operands[i], err = c.operand(side); err != nil {
+			return
+		}
+	}
+	result := "1"
+	if e.op == "IS NOT DISTINCT FROM" {
+		result = "0"
+	}
+	return fmt.Sprintf("CASE WHEN %s = %s OR (%s IS NULL AND %s IS NULL) THEN 0 ELSE 1 END = %s", operands[0], operands[1], operands[2], operands[3], result), nil
+}
+
+func (c *BaseCtx) Column(col *ColumnExpr) (sql string, err error) {
+	return c.Syntax.Quote(col.table.Name()) + "." + c.Syntax.Quote(col.column), nil
+}
+
+// Select writes the clauses of the query separated by spaces, or on separate lines if c.Pretty is set.
+func (c *BaseCtx) Select(s *SelectExpr) (query string, err error) {
+	sql := []string{}
+	selectClause := []string{"SELECT"}
+	if s.distinct {
+		selectClause = append(selectClause, "DISTINCT")
+	}
+	if len(s.distinctOn) > 0 {
+		if err = c.require(CapDistinctOn); err != nil {
+			return
+		}
+		exprs, err := c.list(s.distinctOn)
+		if err != nil {
+			return "", err
+		}
+		selectClause = append(selectClause, "DISTINCT ON ("+exprs+")")
+	}
+	if top := c.Syntax.Top(s.limit, s.offset); top != "" {
+		selectClause = append(selectClause, top)
+	}
+	if s.isSelectStar() {
+		selectClause = append(selectClause, "*")
+	} else {
+		columns := []string{}
+		for _, col := range s.columns {
+			sql, err := col.String(c.outer())
+			if err != nil {
+				return "", err
+			}
+			if _, isSubquery := unwrap(col).(*SelectExpr); isSubquery {
+				// a scalar subquery, as in SELECT (SELECT max(id) FROM t)
+				sql = c.parens(sql)
+			}
+			columns = append(columns, sql)
+		}
+		selectClause = append(selectClause, strings.Join(columns, ", "))
+	}
+	sql = append(sql, strings.Join(selectClause, " "))
+	if len(s.tables) > 0 {
+		from := "FROM"
+		for i, table := range s.tables {
+			tableSQL, err := table.String(c.outer())
+			if err != nil {
+				return "", err
+			}
+			_, isJoin := table.(*JoinExpr)
+			switch {
+			case i == 0:
+				from += " " + tableSQL
+			case !isJoin && c.Pretty:
+				from += ", " + tableSQL
+			case !isJoin: //	two tables without an explicit join condition
+				from += " , " + tableSQL
+			case c.Pretty: //	every join on a line of its own
+				sql = append(sql, from)
+				from = tableSQL
+			default:
+				from += " " + tableSQL
+			}
+		}
+		sql = append(sql, from)
+	}
+	if len(s.conditions) > 0 {
+		where, err := c.where(s.conditions)
+		if err != nil {
+			return "", err
+		}
+		sql = append(sql, where)
+	}
+	if len(s.group) > 0 {
+		groups := []string{}
+		for _, g := range s.group {
+			group, err := g.String(c.outer())
+			if err != nil {
+				return "", err
+			}
+			groups = append(groups, group)
+		}
+		sql = append(sql, "GROUP BY "+strings.Join(groups, ", "))
+	}
+	ordered := false
+	if s.order != nil {
+		order, err := s.order.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		sql = append(sql, order)
+		ordered = order != ""
+	}
+	if limit := c.Syntax.Limit(s.limit, s.offset, ordered); limit != "" {
+		sql = append(sql, limit)
+	}
+	return c.clauses(sql), nil
+}
+
+// where writes the WHERE clause for conditions, which are combined with AND.
+func (c *BaseCtx) where(conditions []Expression) (string, error) {
+	acc := conditions[0]
+	for _, condition := range conditions[1:] {
+		acc = acc.And(condition)
+	}
+	sql, err := acc.String(c.outer())
+	if err != nil {
+		return "", err
+	}
+	return "WHERE " + sql, nil
+}
+
+// clauses joins the clauses of a statement with spaces, or puts them on separate lines if c.Pretty is set.
+func (c *BaseCtx) clauses(sql []string) string {
+	if c.Pretty {
+		return strings.Join(sql, "\n")
+	}
+	return strings.Join(sql, " ")
+}
+
+func (c *BaseCtx) Insert(s *InsertExpr) (string, error) {
+	sql, err := c.insertClauses(s)
+	if err != nil {
+		return "", err
+	}
+	return c.clauses(sql), nil
+}
+
+// insertClauses serializes the clauses of an INSERT statement, for Insert() and the dialects that need to rearrange them.
+func (c *BaseCtx) insertClauses(s *InsertExpr) ([]string, error) {
+	table, err := s.table.String(c.outer())
+	if err != nil {
+		return nil, err
+	}
+	into := "INSERT INTO " + table
+	if len(s.columns) > 0 {
+		columns, err := c.list(s.columns)
+		if err != nil {
+			return nil, err
+		}
+		into += " (" + columns + ")"
+	}
+	sql := []string{into}
+	switch {
+	case s.query != nil:
+		query, err := s.query.String(c.outer())
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, query)
+	case len(s.rows) > 0:
+		rows := []string{}
+		for _, row := range s.rows {
+			values := []string{}
+			for _, value := range row {
+				v, err := c.operand(value)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+			rows = append(rows, "("+strings.Join(values, ", ")+")")
+		}
+		sql = append(sql, "VALUES "+strings.Join(rows, ", "))
+	default:
+		return nil, fmt.Errorf("an INSERT statement needs values or a query")
+	}
+	if s.onConflict {
+		conflict, err := c.onConflict(s)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, conflict)
+	}
+	if len(s.returning) > 0 {
+		returning, err := c.returning(s.returning)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, returning)
+	}
+	return sql, nil
+}
+
+func (c *BaseCtx) onConflict(s *InsertExpr) (string, error) {
+	if err := c.require(CapOnConflict); err != nil {
+		return "", err
+	}
+	conflict := "ON CONFLICT"
+	if len(s.conflictTarget) > 0 {
+		target, err := c.list(s.conflictTarget)
+		if err != nil {
+			return "", err
+		}
+		conflict += " (" + target + ")"
+	}
+	if len(s.conflictColumns) == 0 {
+		return conflict + " DO NOTHING", nil
+	}
+	assignments, err := c.assignments(s.conflictColumns, s.conflictValues)
+	if err != nil {
+		return "", err
+	}
+	return conflict + " DO UPDATE SET " + assignments, nil
+}
+
+// assignments serializes the column = value pairs of a SET clause.
+func (c *BaseCtx) assignments(columns, values []Expression) (string, error) {
+	assignments := []string{}
+	for i, column := range columns {
+		name, err := column.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		value, err := c.operand(values[i])
+		if err != nil {
+			return "", err
+		}
+		assignments = append(assignments, name+" = "+value)
+	}
+	return strings.Join(assignments, ", "), nil
+}
+
+func (c *BaseCtx) returning(columns []Expression) (string, error) {
+	if err := c.require(CapReturning); err != nil {
+		return "", err
+	}
+	list, err := c.list(columns)
+	if err != nil {
+		return "", err
+	}
+	return "RETURNING " + list, nil
+}
+
+func (c *BaseCtx) Update(s *UpdateExpr) (string, error) {
+	sql, err := c.updateClauses(s)
+	if err != nil {
+		return "", err
+	}
+	return c.clauses(sql), nil
+}
+
+// updateClauses serializes the clauses of an UPDATE statement, like insertClauses().
+func (c *BaseCtx) updateClauses(s *UpdateExpr) ([]string, error) {
+	if len(s.columns) == 0 {
+		return nil, fmt.Errorf("an UPDATE statement needs at least one column to set")
+	}
+	table, err := s.table.String(c.outer())
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := c.assignments(s.columns, s.values)
+	if err != nil {
+		return nil, err
+	}
+	sql := []string{"UPDATE " + table, "SET " + assignments}
+	if len(s.conditions) > 0 {
+		where, err := c.where(s.conditions)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, where)
+	}
+	if len(s.returning) > 0 {
+		returning, err := c.returning(s.returning)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, returning)
+	}
+	return sql, nil
+}
+
+func (c *BaseCtx) Delete(s *DeleteExpr) (string, error) {
+	sql, err := c.deleteClauses(s)
+	if err != nil {
+		return "", err
+	}
+	return c.clauses(sql), nil
+}
+
+// deleteClauses serializes the clauses of a DELETE statement, like insertClauses().
+func (c *BaseCtx) deleteClauses(s *DeleteExpr) ([]string, error) {
+	table, err := s.table.String(c.outer())
+	if err != nil {
+		return nil, err
+	}
+	sql := []string{"DELETE FROM " + table}
+	if len(s.conditions) > 0 {
+		where, err := c.where(s.conditions)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, where)
+	}
+	if len(s.returning) > 0 {
+		returning, err := c.returning(s.returning)
+		if err != nil {
+			return nil, err
+		}
+		sql = append(sql, returning)
+	}
+	return sql, nil
+}
+
+func (c *BaseCtx) Alias(alias *AliasExpr) (sql string, err error) {
+	source, err := alias.Source.String(c.outer())
+	if err != nil {
+		return
+	}
+	if alias.Source.IsCompound() {
+		source = c.parens(source)
+	}
+	name, err := alias.Expression.String(c.outer())
+	if err != nil {
+		return
+	}
+	sql = source + " AS " + name
+	return
+}
+
+func (c *BaseCtx) QuotedIdentifier(id QuotedIdentifier) (string, error) {
+	return c.Syntax.Quote(string(id)), nil
+}
+
+// placeholder returns the placeholder for the nth value.
+func (c *BaseCtx) placeholder(n int) string {
+	if c.inline {
+		return inlineMarker(n)
+	}
+	return c.Syntax.Placeholder(n)
+}
+
+func (c *BaseCtx) StaticPlaceholder(value interface{}) (sql string, err error) {
+	list, ok := value.([]interface{})
+	if ok {
+		strs := []string{}
+		for _, e := range list {
+			sql, err = c.StaticPlaceholder(e)
+			if err != nil {
+				return
+			}
+			strs = append(strs, sql)
+		}
+		sql = strings.Join(strs, ",")
+		return
+	}
+	c.placeholderValues = append(c.placeholderValues, value)
+	sql = c.placeholder(len(c.placeholderValues))
+	return
+}
+
+func (c *BaseCtx) DynamicPlaceholder(b *Binding) (sql string, err error) {
+	if c.referenced == nil {
+		c.referenced = make(map[string]bool)
+		c.placeholderNameToIndexes = make(map[string][]int)
+	}
+	c.referenced[b.name] = true
+	existing, seen := c.placeholderNameToIndexes[b.name]
+	if seen && !c.Syntax.Positional() {
+		strs := []string{}
+		for _, i := range existing {
+			strs = append(strs, c.placeholder(i))
+		}
+		sql = strings.Join(strs, ",")
+		return
+	}
+	n := 1
+	bound, ok := c.dynamicValues[b.name]
+	if !ok {
+		// SQLString() has no values, so this is only an error in SQL()
+		if c.checkBindings && !seen {
+			c.unbound = append(c.unbound, b.name)
+		}
+	} else if bound == nil {
+		return "NULL", nil // formatted as IS NULL instead in comparisons
+	} else if v := reflect.ValueOf(bound); v.Kind() == reflect.Slice {
+		n = v.Len()
+	}
+	strs := []string{}
+	for i := 0; i < n; i++ {
+		c.placeholderValues = append(c.placeholderValues, nil)
+		c.placeholderNameToIndexes[b.name] = append(c.placeholderNameToIndexes[b.name], len(c.placeholderValues))
+		strs = append(strs, c.placeholder(len(c.placeholderValues)))
+	}
+	sql = strings.Join(strs, ",")
+	return
+}
+
+func (c *BaseCtx) Join(j *JoinExpr) (sql string, err error) {
+	if j.kind == OuterJoinKind {
+		if err = c.require(CapFullJoin); err != nil {
+			return
+		}
+	}
+	join, err := c.Syntax.JoinKeyword(j.kind)
+	if err != nil {
+		return "", err
+	}
+	tableSql, err := j.table.String(c.outer())
+	if err != nil {
+		return "", err
+	}
+	if j.condition == nil {
+		return join + " " + tableSql, nil
+	}
+	conditionSql, err := j.condition.String(c.outer())
+	if err != nil {
+		return "", err
+	}
+	return join + " " + tableSql + " " + conditionSql, nil
+}
+
+func (c *BaseCtx) JoinCondition(jc *JoinCondition) (sql string, err error) {
+	switch jc.kind {
+	case JoinOn:
+		sql, err := jc.condition.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		return "ON (" + sql + ")", nil
+	case JoinUsing:
+		sql, err := jc.condition.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		return "USING (" + sql + ")", nil
+	}
+	return "", fmt.Errorf("Could not use %v [%v] as a join condition", jc, reflect.TypeOf(jc))
+}
+
+func (c *BaseCtx) In(in *InExpr) (sql string, err error) {
+	if isEmptyList(c.outer(), in.list) {
+		// still serialize the list to record its bindings; it does not produce any placeholders
+		if _, err = in.list.String(c.outer()); err != nil {
+			return "", err
+		}
+		if in.not {
+			return c.Syntax.Boolean(true), nil
+		}
+		return c.Syntax.Boolean(false), nil
+	}
+	element, err := in.element.String(c.outer())
+	if err != nil {
+		return "", err
+	}
+	list, err := in.list.String(c.outer())
+	if err != nil {
+		return "", err
+	}
+	if in.list.IsCompound() {
+		list = c.parens(list)
+	}
+	if in.not {
+		return element + " NOT IN " + list, nil
+	}
+	return element + " IN " + list, nil
+}
+
+func (c *BaseCtx) Cast(cast *CastExpr) (sql string, err error) {
+	sql, err = cast.e.String(c.outer())
+	if err != nil {
+		return
+	}
+	sql = c.Syntax.Cast(sql, cast.typ)
+	return
+}
+
+func (c *BaseCtx) Func(f *FuncExpr) (sql string, err error) {
+	args := []string{}
+	for _, e := range f.values {
+		arg, err := e.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	return f.name + "(" + strings.Join(args, ", ") + ")", nil
+}
+
+func (c *BaseCtx) AggFunc(f *AggFuncExpr) (sql string, err error) {
+	if f.distinct && f.all {
+		return "", fmt.Errorf("an aggregate function cannot use both DISTINCT and ALL")
+	}
+	args := []string{}
+	for _, e := range f.values {
+		arg, err := e.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	var qualifier string
+	if f.distinct {
+		qualifier = "DISTINCT "
+	}
+	if f.all {
+		qualifier = "ALL "
+	}
+	var order string
+	if f.order != nil {
+		order, err = f.order.String(c.outer())
+		if err != nil {
+			return
+		}
+		order = " " + order
+	}
+	return f.name + "(" + qualifier + strings.Join(args, ", ") + order + ")", nil
+}
+
+func (c *BaseCtx) OrderBy(order *OrderExpr) (sql string, err error) {
+	if len(order.exprs) == 0 {
+		return
+	}
+	parts := []string{}
+	for _, o := range order.exprs {
+		part, err := o.column.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		if o.order == OrderAsc {
+			part += " ASC"
+		}
+		if o.order == OrderDesc {
+			part += " DESC"
+		}
+		parts = append(parts, part)
+	}
+	sql = "ORDER BY " + strings.Join(parts, ", ")
+	return
+}
+
+// list serializes exprs as a comma-separated list.
+func (c *BaseCtx) list(exprs []Expression) (string, error) {
+	strs := []string{}
+	for _, e := range exprs {
+		sql, err := e.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		strs = append(strs, sql)
+	}
+	return strings.Join(strs, ", "), nil
+}
+
+func (c *BaseCtx) Window(w *WindowExpr) (sql string, err error) {
+	if err = c.require(CapWindowFunctions); err != nil {
+		return
+	}
+	fn, err := w.fn.String(c.outer())
+	if err != nil {
+		return
+	}
+	spec := []string{}
+	if len(w.partition) > 0 {
+		partition, err := c.list(w.partition)
+		if err != nil {
+			return "", err
+		}
+		spec = append(spec, "PARTITION BY "+partition)
+	}
+	if w.order != nil {
+		order, err := w.order.String(c.outer())
+		if err != nil {
+			return "", err
+		}
+		if order != "" {
+			spec = append(spec, order)
+		}
+	}
+	return fn + " OVER (" + strings.Join(spec, " ") + ")", nil
+}
+
+// Compile serializes e and records where the bindings went, like Compiler.Compile().
+// rejectUnused makes Args keys that the query does not reference an error.
+// A BaseCtx is meant to serialize a single query, so Compile must only be called once.
+func (c *BaseCtx) Compile(e Expression, v Args, rejectUnused bool) (t *Template, err error) {
+	c.dynamicValues = v
+	c.checkBindings = true
+	sql, err := e.String(c.outer())
+	if err != nil {
+		return nil, err
+	}
+	if err = c.validate(rejectUnused); err != nil {
+		return nil, err
+	}
+	t = &Template{SQL: sql, Values: c.placeholderValues, Bindings: make(map[string][]int, len(c.placeholderNameToIndexes))}
+	for name, indexes := range c.placeholderNameToIndexes {
+		for _, index := range indexes {
+			t.Bindings[name] = append(t.Bindings[name], index-1)
+		}
+	}
+	return
+}
+
+// SQLString serializes e without any Args, like Dialect.SQLString().
+func (c *BaseCtx) SQLString(e Expression) (string, error) {
+	return e.String(c.outer())
+}
+
+// validate checks the bindings referenced during serialization against the provided Args.
+func (c *BaseCtx) validate(rejectUnused bool) error {
+	bindingErr := &BindingError{Unbound: c.unbound}
+	if rejectUnused {
+		for _, k := range c.dynamicValues.keys() {
+			if !c.referenced[k] {
+				bindingErr.Unused = append(bindingErr.Unused, k)
+			}
+		}
+	}
+	if len(bindingErr.Unbound) == 0 && len(bindingErr.Unused) == 0 {
+		return nil
+	}
+	sort.Strings(bindingErr.Unbound)
+	return bindingErr
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 
 	_ "github.com/lib/pq"
 )
@@ -12,10 +14,26 @@ import (
 type Dbq struct {
 	Dialect
 	*sql.DB
+	mapper     NameMapper
+	fields     fieldCache
+	scanMode   ScanMode
+	converters converterRegistry
+	cache      *templateCache
 }
 
 type Args map[string]interface{}
 
+// keys returns the names in the map in sorted order.
+// Whenever the contents of an Args value affect the generated SQL, they must be visited in this order, so that the output is deterministic.
+func (a Args) keys() []string {
+	keys := make([]string, 0, len(a))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 type AliasExpr struct {
 	Expression // alias
 	Source     Node
@@ -26,11 +44,57 @@ type Identifier string
 func (Identifier) IsCompound() bool              { return false }
 func (id Identifier) String(Ctx) (string, error) { return string(id), nil }
 
+// QuotedIdentifier is an identifier that the dialect quotes, such as a column name with spaces. Parse() creates them from quoted names.
+type QuotedIdentifier string
+
+func (QuotedIdentifier) IsCompound() bool                { return false }
+func (id QuotedIdentifier) String(c Ctx) (string, error) { return c.QuotedIdentifier(id) }
+
+// QualifiedName is a name made of several parts, such as schema.table, each of which is an Identifier or a QuotedIdentifier.
+type QualifiedName []Node
+
+func (QualifiedName) IsCompound() bool { return false }
+
+func (name QualifiedName) String(c Ctx) (string, error) {
+	parts := []string{}
+	for _, part := range name {
+		sql, err := part.String(c)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, sql)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// unquoted returns the name as a single string, without quotes.
+func (name QualifiedName) unquoted() string {
+	parts := []string{}
+	for _, part := range name {
+		switch part := part.(type) {
+		case Identifier:
+			parts = append(parts, string(part))
+		case QuotedIdentifier:
+			parts = append(parts, string(part))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
 type IdentExpr struct {
 	Expr
 }
 
-func (id *IdentExpr) Name() string { return string(id.Node.(Identifier)) }
+// Name returns the identifier without quotes.
+func (id *IdentExpr) Name() string {
+	switch n := id.Node.(type) {
+	case QuotedIdentifier:
+		return string(n)
+	case QualifiedName:
+		return n.unquoted()
+	}
+	return string(id.Node.(Identifier))
+}
 func (id *IdentExpr) Col(column string) Expression {
 	return &Expr{&ColumnExpr{table: id, column: column}}
 }
@@ -52,6 +116,11 @@ type Nullable interface {
 	IsNull(Ctx) bool
 }
 
+func isNull(c Ctx, n Node) bool {
+	nullable, ok := n.(Nullable)
+	return ok && nullable.IsNull(c)
+}
+
 type ColumnExpr struct {
 	table  Tabular
 	column string
@@ -62,6 +131,12 @@ func (col *ColumnExpr) String(c Ctx) (string, error) {
 	return c.Column(col)
 }
 
+// Table returns the table that the column belongs to.
+func (col *ColumnExpr) Table() Tabular { return col.table }
+
+// Column returns the name of the column.
+func (col *ColumnExpr) Column() string { return col.column }
+
 // NewQ returns a new dbq handle.
 func NewQ(db *sql.DB, d Dialect) *Dbq {
 	return &Dbq{Dialect: d, DB: db}
@@ -70,8 +145,10 @@ func NewQ(db *sql.DB, d Dialect) *Dbq {
 // Alias returns an alias expression.
 //
 // source can be of the following types:
-//   string - will be cast to an Identifier
-//   Node - will be used as is
+//
+//	string - will be cast to an Identifier
+//	Node - will be used as is
+//
 // Anything else will panic.
 func Alias(source interface{}, name string) *AliasExpr {
 	var tabular Node
@@ -106,6 +183,11 @@ func Ident(id string) TabularExpression {
 	return &IdentExpr{Expr: Expr{Identifier(id)}}
 }
 
+// ident returns an identifier expression for an Identifier, a QuotedIdentifier or a QualifiedName.
+func ident(name Node) TabularExpression {
+	return &IdentExpr{Expr: Expr{name}}
+}
+
 // LiteralInt64 represents an SQL integer literal.
 type LiteralInt64 int64
 
@@ -126,6 +208,15 @@ type LiteralList []interface{}
 func (LiteralList) IsCompound() bool               { return true }
 func (l LiteralList) String(c Ctx) (string, error) { return c.StaticPlaceholder([]interface{}(l)) }
 
+// LiteralValue represents any other Go value. Like LiteralString, it is passed to the database in an implicit placeholder.
+// *Dbq.SQL() fails if the value is neither accepted by database/sql, e.g. a driver.Valuer, nor handled by a registered Converter.
+type LiteralValue struct {
+	Value interface{}
+}
+
+func (LiteralValue) IsCompound() bool               { return false }
+func (v LiteralValue) String(c Ctx) (string, error) { return c.StaticPlaceholder(v.Value) }
+
 type LiteralNull struct{}
 
 func (LiteralNull) IsCompound() bool           { return false }
@@ -147,9 +238,12 @@ func Literal(value interface{}) Expression {
 		return &Expr{LiteralString(value)}
 	case []interface{}:
 		return &Expr{LiteralList(value)}
-	default:
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
 		panic(fmt.Errorf("Cannot create a literal from %v [%v]", value, reflect.TypeOf(value)))
 	}
+	return &Expr{LiteralValue{value}}
 }
 
 type BinaryOp struct {
@@ -162,14 +256,16 @@ func (op *BinaryOp) String(c Ctx) (string, error) {
 	return c.BinaryOp(op)
 }
 
+func (op *BinaryOp) Left() Expression  { return op.a }
+func (op *BinaryOp) Right() Expression { return op.b }
+func (op *BinaryOp) Op() string        { return op.op }
+
 func operandToExpression(v interface{}) Expression {
 	switch v := v.(type) {
 	case Expression:
 		return v
-	case int, int32, int64, string, nil:
-		return Literal(v)
 	default:
-		panic(fmt.Errorf("Cannot create an expression from %v [%v]", v, reflect.TypeOf(v)))
+		return Literal(v)
 	}
 }
 
@@ -187,6 +283,9 @@ func toInterfaceSlice(v interface{}) (result []interface{}, ok bool) {
 }
 
 func listToExpression(v interface{}) Expression {
+	if v == nil {
+		return Literal([]interface{}{})
+	}
 	expr, isExpr := v.(Expression)
 	if isExpr {
 		return expr
@@ -206,6 +305,7 @@ func Binary(a interface{}, op string, b interface{}) Expression {
 type InExpr struct {
 	element Expression
 	list    Expression
+	not     bool
 	Primitive
 }
 
@@ -213,13 +313,50 @@ func (in *InExpr) String(c Ctx) (string, error) {
 	return c.In(in)
 }
 
+func (in *InExpr) Element() Expression { return in.element }
+func (in *InExpr) List() Expression    { return in.list }
+func (in *InExpr) Not() bool           { return in.not } // whether it is NOT IN
+
 // In returns an IN(...) expression. The argument can be an Expression (probably a LiteralList) or a []interface{}, in which case a number of implicit placeholders may be generated.
+//
+// An empty list, or a binding to nil or an empty slice, makes the expression FALSE.
 func In(element interface{}, list interface{}) Expression {
 	elementEx := operandToExpression(element)
 	listEx := listToExpression(list)
 	return &Expr{&InExpr{element: elementEx, list: listEx}}
 }
 
+// NotIn returns a NOT IN(...) expression. It accepts the same arguments as In().
+//
+// An empty list, or a binding to nil or an empty slice, makes the expression TRUE.
+func NotIn(element interface{}, list interface{}) Expression {
+	elementEx := operandToExpression(element)
+	listEx := listToExpression(list)
+	return &Expr{&InExpr{element: elementEx, list: listEx, not: true}}
+}
+
+// isEmptyList reports whether an IN list is known to have no elements.
+func isEmptyList(c Ctx, n Node) bool {
+	switch n := n.(type) {
+	case *Expr:
+		return isEmptyList(c, n.Node)
+	case LiteralList:
+		return len(n) == 0
+	case *Binding:
+		v, ok := c.BindValue(n)
+		if !ok {
+			return false
+		}
+		if v == nil {
+			return true
+		}
+		list := reflect.ValueOf(v)
+		return list.Kind() == reflect.Slice && list.Len() == 0
+	default:
+		return false
+	}
+}
+
 type Binding struct {
 	name     string
 	Compound // required to work with IN(). should be cleaned up, maybe.
@@ -229,6 +366,8 @@ func (b *Binding) String(c Ctx) (string, error) {
 	return c.DynamicPlaceholder(b)
 }
 
+func (b *Binding) Name() string { return b.name }
+
 func (b *Binding) IsNull(c Ctx) bool {
 	v, ok := c.BindValue(b)
 	return ok && v == nil
@@ -238,6 +377,7 @@ func (b *Binding) IsNull(c Ctx) bool {
 //
 // Concrete values can be specified when calling *Dbq.SQL().
 // Note that the string representation returned by *Dbq.SQL() may changed based on the values provided.
+// A binding without a value makes *Dbq.SQL() fail with a *BindingError; NULL must be bound explicitly as nil.
 func Bind(name string) Expression {
 	return &Expr{&Binding{name: name}}
 }
@@ -257,6 +397,9 @@ func (cast *CastExpr) String(c Ctx) (string, error) {
 	return c.Cast(cast)
 }
 
+func (cast *CastExpr) Value() Expression { return cast.e }
+func (cast *CastExpr) Type() string      { return cast.typ }
+
 type FuncExpr struct {
 	name   string
 	values []Expression
@@ -267,6 +410,11 @@ func (f *FuncExpr) String(c Ctx) (string, error) {
 	return c.Func(f)
 }
 
+func (f *FuncExpr) Name() string { return f.name }
+
+// Args returns a copy of the arguments.
+func (f *FuncExpr) Args() []Expression { return append([]Expression(nil), f.values...) }
+
 func Func(name string, args ...Expression) Expression {
 	return &Expr{&FuncExpr{name: name, values: args}}
 }
@@ -283,6 +431,14 @@ func (f *AggFuncExpr) String(c Ctx) (string, error) {
 	return c.AggFunc(f)
 }
 
+func (f *AggFuncExpr) Name() string   { return f.name }
+func (f *AggFuncExpr) Distinct() bool { return f.distinct }
+func (f *AggFuncExpr) All() bool      { return f.all }
+func (f *AggFuncExpr) Order() Node    { return f.order } // the ORDER BY within the call, or nil
+
+// Args returns a copy of the arguments.
+func (f *AggFuncExpr) Args() []Expression { return append([]Expression(nil), f.values...) }
+
 func AggFunc(name string, args ...interface{}) Expression {
 	e := &AggFuncExpr{name: name, values: []Expression{}}
 	for _, arg := range args {
@@ -322,6 +478,12 @@ func (order *OrderExpr) String(c Ctx) (string, error) {
 	return c.OrderBy(order)
 }
 
+// Clauses returns a copy of the ordering terms.
+func (order *OrderExpr) Clauses() []OrderClause { return append([]OrderClause(nil), order.exprs...) }
+
+func (clause OrderClause) Column() Expression { return clause.column }
+func (clause OrderClause) Order() OrderKind   { return clause.order }
+
 func OrderBy(clauses ...interface{}) *OrderExpr {
 	orderExpr := &OrderExpr{}
 	for _, clause := range clauses {
@@ -365,3 +527,79 @@ func Order(column interface{}, order interface{}) (result OrderClause) {
 	}
 	return
 }
+
+// toExpressions converts column specifications to Expressions: strings are identifiers, and Expressions are used as is.
+func toExpressions(specs []interface{}) (exprs []Expression) {
+	for _, spec := range specs {
+		switch spec := spec.(type) {
+		case string:
+			exprs = append(exprs, Ident(spec))
+		case Expression:
+			exprs = append(exprs, spec)
+		default:
+			panic(fmt.Errorf("cannot use %v [%v] as an expression", spec, reflect.TypeOf(spec)))
+		}
+	}
+	return
+}
+
+// DistinctOnClause represents the DISTINCT ON keyword with its expressions. It is created with DistinctOn().
+type DistinctOnClause struct {
+	exprs []Expression
+}
+
+// DistinctOn returns a column specification for Select() that keeps only the first row of each set of rows with equal values of exprs.
+// It requires CapDistinctOn.
+func DistinctOn(exprs ...interface{}) DistinctOnClause {
+	return DistinctOnClause{exprs: toExpressions(exprs)}
+}
+
+// WindowExpr represents a window function call.
+type WindowExpr struct {
+	fn        Expression
+	partition []Expression
+	order     *OrderExpr
+	Primitive
+}
+
+// PartitionClause represents the PARTITION BY part of a window. It is created with PartitionBy().
+type PartitionClause struct {
+	exprs []Expression
+}
+
+// PartitionBy returns a window specification for Over().
+func PartitionBy(exprs ...interface{}) PartitionClause {
+	return PartitionClause{exprs: toExpressions(exprs)}
+}
+
+func (w *WindowExpr) String(c Ctx) (string, error) {
+	return c.Window(w)
+}
+
+func (w *WindowExpr) Func() Expression  { return w.fn }
+func (w *WindowExpr) Order() *OrderExpr { return w.order } // nil if the window is unordered
+
+// Partition returns a copy of the PARTITION BY expressions.
+func (w *WindowExpr) Partition() []Expression { return append([]Expression(nil), w.partition...) }
+
+/*
+Over applies a window to a function call:
+
+	Over(Func("row_number"), PartitionBy("dept"), OrderBy(Order("salary", "desc")))
+
+spec can contain a PartitionClause and an *OrderExpr. Window functions require CapWindowFunctions.
+*/
+func Over(fn Expression, spec ...interface{}) Expression {
+	w := &WindowExpr{fn: fn}
+	for _, s := range spec {
+		switch s := s.(type) {
+		case PartitionClause:
+			w.partition = append(w.partition, s.exprs...)
+		case *OrderExpr:
+			w.order = s
+		default:
+			panic(fmt.Errorf("cannot use %v [%v] as a window specification", s, reflect.TypeOf(s)))
+		}
+	}
+	return &Expr{w}
+}
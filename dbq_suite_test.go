@@ -1,9 +1,16 @@
 package dbq
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	_ "github.com/mattn/go-sqlite3"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -32,6 +39,54 @@ func exec(db *sql.DB, q string) {
 	}
 }
 
+type money struct {
+	cents int64
+}
+
+var moneyConverter = ConverterFuncs{
+	ValueFunc: func(v interface{}) (driver.Value, error) {
+		return v.(money).cents, nil
+	},
+	ScanFunc: func(src interface{}, dest interface{}) error {
+		cents, ok := src.(int64)
+		if !ok {
+			return fmt.Errorf("cannot scan %T into money", src)
+		}
+		dest.(*money).cents = cents
+		return nil
+	},
+}
+
+// bracketSyntax is a custom dialect syntax, as a third party would define it.
+type bracketSyntax struct {
+	PostgresSyntax
+}
+
+func (bracketSyntax) Quote(ident string) string { return "[" + ident + "]" }
+
+// minimalDialect implements only the methods of Dialect, as a third party dialect written before Compiler and Interpolator would.
+// noWindowSyntax lacks window functions.
+type noWindowSyntax struct {
+	DefaultSyntax
+}
+
+func (noWindowSyntax) Capabilities() Capability { return CapFullJoin }
+
+// funcSyntax cannot be fingerprinted for the template cache.
+type funcSyntax struct {
+	DefaultSyntax
+	quote func(string) string
+}
+
+func (s funcSyntax) Quote(ident string) string { return s.quote(ident) }
+
+type minimalDialect struct{}
+
+func (minimalDialect) SQL(e Expression, v Args) (string, []interface{}, error) {
+	return PostgresDialect{}.SQL(e, v)
+}
+func (minimalDialect) SQLString(e Expression) (string, error) { return PostgresDialect{}.SQLString(e) }
+
 func testschema(db *sql.DB) {
 	exec(db, "CREATE TABLE test ( id serial, a integer, b integer, primary key (id) )")
 }
@@ -107,6 +162,33 @@ var _ = Describe("dbq", func() {
 			Expect(Q(e)).To(Equal("SELECT a, a1, b AS b_alias, (2 + 2) AS c FROM t"))
 		})
 
+		Describe("builder methods", func() {
+			It("should not modify the receiver", func() {
+				base := q.Select().From("t").Where(Ident("x").Eq(1))
+				a := base.Where(Ident("y").Eq(2)).OrderBy("y").Limit(5)
+				b := base.Where(Ident("z").Eq(3)).Group("z").Offset(10)
+				Expect(Q(base)).To(Equal("SELECT * FROM t WHERE x = 1"))
+				Expect(Q(a)).To(Equal("SELECT * FROM t WHERE (x = 1) AND (y = 2) ORDER BY y LIMIT 5"))
+				Expect(Q(b)).To(Equal("SELECT * FROM t WHERE (x = 1) AND (z = 3) GROUP BY z OFFSET 10"))
+			})
+			It("should not share state between variants", func() {
+				base := q.Select().From("t").Where(Ident("x").Eq(1), Ident("y").Eq(2))
+				a := base.Where(Ident("a").Eq(1))
+				b := base.Where(Ident("b").Eq(1))
+				Expect(Q(a)).To(Equal("SELECT * FROM t WHERE ((x = 1) AND (y = 2)) AND (a = 1)"))
+				Expect(Q(b)).To(Equal("SELECT * FROM t WHERE ((x = 1) AND (y = 2)) AND (b = 1)"))
+			})
+		})
+
+		Describe("Clone()", func() {
+			It("should return an equivalent query", func() {
+				s := q.Select("a").From("t").Where(Ident("x").Eq(1)).Limit(1)
+				cl := s.Clone()
+				Expect(cl).NotTo(BeIdenticalTo(s))
+				Expect(Q(cl)).To(Equal(Q(s)))
+			})
+		})
+
 		Describe("From()", func() {
 			It("should add a table to the FROM clause", func() {
 				s = q.Select().From("t")
@@ -154,6 +236,14 @@ var _ = Describe("dbq", func() {
 				s := q.Select().From("t").Where(Args{"x": 42})
 				Expect(Q(s)).To(Equal("SELECT * FROM t WHERE x = 42"))
 			})
+			It("should order map conditions by name", func() {
+				s := q.Select().From("t").Where(Args{"z": "c", "x": "a", "y": []string{"b1", "b2"}, "w": nil})
+				for i := 0; i < 10; i++ {
+					sql, v := QB(s)
+					Expect(sql).To(Equal("SELECT * FROM t WHERE (((w IS NULL) AND (x = $1)) AND y IN ($2,$3)) AND (z = $4)"))
+					Expect(v).To(Equal([]interface{}{"a", "b1", "b2", "c"}))
+				}
+			})
 			It("should take lists in a map", func() {
 				s := q.Select().From("t").Where(Args{"x": []int{42, 57}}).Where(Args{"y": []string{"c"}})
 				sql, v := QB(s)
@@ -247,116 +337,1759 @@ var _ = Describe("dbq", func() {
 				Expect(a[1].A).To(Equal(43))
 				Expect(a[1].B).To(Equal(2))
 			})
-		})
-
-	})
-
-	Describe("Alias", func() {
-		It("should be an expression", func() {
-			alias := Alias(Literal(2).Mult(Literal(2)), "x")
-			eq := alias.Eq(Literal(4))
-			Expect(Q(alias)).To(Equal("(2 * 2) AS x"))
-			Expect(Q(eq)).To(Equal("x = 4"))
-		})
-	})
-
-	Describe("Col()", func() {
-		It("should be usable on identifiers", func() {
-			t := Ident("t")
-			Expect(Q(t.Col("a"))).To(Equal(`"t"."a"`))
-		})
-		It("should be usable on aliases", func() {
-			t := Alias("table", "t")
-			Expect(Q(t.Col("a"))).To(Equal(`"t"."a"`))
-		})
-		It("should support operators", func() {
-			t := Ident("t")
-			expr := t.Col("a").Eq(t.Col("b"))
-			Expect(Q(expr)).To(Equal(`"t"."a" = "t"."b"`))
-		})
-	})
-
-	Describe("Binary()", func() {
-		It("should use =", func() { Expect(Q(Literal(1).Eq(1))).To(Equal("1 = 1")) })
-		It("should use !=", func() { Expect(Q(Literal(1).NotEq(1))).To(Equal("1 != 1")) })
-		It("should use <", func() { Expect(Q(Literal(1).Less(1))).To(Equal("1 < 1")) })
-		It("should use <=", func() { Expect(Q(Literal(1).LessEq(1))).To(Equal("1 <= 1")) })
-		It("should use >", func() { Expect(Q(Literal(1).Greater(1))).To(Equal("1 > 1")) })
-		It("should use >=", func() { Expect(Q(Literal(1).GreaterEq(1))).To(Equal("1 >= 1")) })
-
-		It("should nest", func() {
-			expr1 := Literal(2).Plus(Literal(3)).Mult(Literal(5))
-			expr2 := Literal(2).Plus(Literal(3).Mult(Literal(5)))
-			Expect(Q(expr1)).To(Equal("(2 + 3) * 5"))
-			Expect(Q(expr2)).To(Equal("2 + (3 * 5)"))
-		})
-
-		It("should turn go values into expressions", func() {
-			expr := Binary(42, "=", "42")
-			sql, v := QB(expr)
-			Expect(sql).To(Equal("42 = $1"))
-			Expect(v[0].(string)).To(Equal("42"))
-		})
-		It("should support = with nulls", func() {
-			expr := Ident("x").Eq(nil)
-			Expect(Q(expr)).To(Equal("x IS NULL"))
-		})
-		It("should support != with nulls", func() {
-			expr := Ident("x").NotEq(nil)
-			Expect(Q(expr)).To(Equal("x IS NOT NULL"))
-		})
-	})
-
-	Describe("Bind()", func() {
-		It("should be mappable to values", func() {
-			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
-			sql, v, _ := q.SQL(e, Args{"myValue": 42})
-			Expect(sql).To(Equal("SELECT * FROM t WHERE x = ($1)"))
-			Expect(v).To(HaveLen(1))
-			Expect(v[0]).To(Equal(42))
-		})
-		It("should be reusable", func() {
-			e := q.Select().From("t").Where(Bind("myValue").Eq(Bind("myValue")))
-			sql, v, _ := q.SQL(e, Args{"myValue": 42})
-			Expect(sql).To(Equal("SELECT * FROM t WHERE ($1) = ($1)"))
-			Expect(v).To(HaveLen(1))
-			Expect(v[0]).To(Equal(42))
-		})
-		It("should play nicely with string literals", func() {
-			e := q.Select().From("t").Where(Ident("a").Eq("meh")).Where(Ident("x").Eq(Bind("myValue")))
-			sql, v, _ := q.SQL(e, Args{"myValue": 42})
-			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = $1) AND (x = ($2))"))
-			Expect(v).To(HaveLen(2))
-			Expect(v[0]).To(Equal("meh"))
-			Expect(v[1]).To(Equal(42))
-		})
-		It("should support = with nulls", func() {
-			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
-			sql, v, _ := q.SQL(e, Args{"myValue": nil})
-			Expect(sql).To(Equal("SELECT * FROM t WHERE x IS NULL"))
-			Expect(v).To(BeEmpty())
-		})
-	})
-
-	Describe("In()", func() {
-		It("should take a go value and make it into placeholders", func() {
-			s := Ident("a").In([]int{1, 2, 5})
-			sql, v := QB(s)
-			Expect(sql).To(Equal("a IN ($1,$2,$3)"))
-			Expect(v).To(HaveLen(3))
-			Expect(v[0]).To(Equal(1))
-			Expect(v[1]).To(Equal(2))
-			Expect(v[2]).To(Equal(5))
-		})
-		It("should take a binding", func() {
-			s := Ident("a").In(Bind("myArray"))
-			sql, v, _ := q.SQL(s, Args{"myArray": []string{"a", "b", "c"}})
-			Expect(sql).To(Equal("a IN ($1,$2,$3)"))
-			Expect(v).To(HaveLen(3))
-			Expect(v[0]).To(Equal("a"))
-			Expect(v[1]).To(Equal("b"))
-			Expect(v[2]).To(Equal("c"))
-		})
+			It("should map columns by struct tags", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					First  int `db:"a"`
+					B      int `db:"-"`
+					hidden int
+				}
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.First).To(Equal(42))
+				Expect(a.B).To(Equal(0))
+				Expect(a.hidden).To(Equal(0))
+			})
+			It("should flatten embedded structs", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type ids struct {
+					ID int
+				}
+				var a struct {
+					ids
+					A int
+				}
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.ID).NotTo(Equal(0))
+				Expect(a.A).To(Equal(42))
+			})
+			It("should fill nested structs from prefixed columns", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type pair struct {
+					A int
+					B int
+				}
+				var a struct {
+					Dotted   pair
+					Prefixed pair `db:",prefix=p_"`
+				}
+				e = q.Select(Alias("a", `"dotted.a"`), Alias("b", `"dotted.b"`), Alias("a", "p_a"), Alias("b", "p_b")).From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.Dotted).To(Equal(pair{A: 42, B: 1}))
+				Expect(a.Prefixed).To(Equal(pair{A: 42, B: 1}))
+			})
+			It("should allocate embedded struct pointers", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type Pair struct {
+					A int
+					B int
+				}
+				var a struct {
+					ID int
+					*Pair
+				}
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.Pair).To(Equal(&Pair{A: 42, B: 1}))
+			})
+			It("should leave nested struct pointers nil if all their columns are NULL", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (id, a, b) VALUES (1, 10, NULL), (2, 20, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type author struct {
+					ID int
+					A  int
+				}
+				type post struct {
+					A      int
+					Author *author `db:",prefix=author_"`
+				}
+				t, u := Ident("t"), Ident("u")
+				var posts []post
+				e = q.Select(t.Col("a"), Alias(u.Col("id"), "author_id"), Alias(u.Col("a"), "author_a")).
+					From(Alias("test", "t"), LeftJoin(Alias("test", "u"), On(t.Col("b").Eq(u.Col("id"))))).
+					OrderBy(t.Col("id")).
+					Into(&posts)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(posts).To(Equal([]post{{A: 10}, {A: 20, Author: &author{ID: 1, A: 10}}}))
+			})
+			It("should fail on NULL in a plain field of an allocated struct pointer", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type pair struct {
+					A int
+					B int
+				}
+				var a struct {
+					Pair *pair `db:",prefix="`
+				}
+				e = q.Select("a", "b").From("test").Into(&a)
+				Expect(e).To(HaveOccurred())
+				e = q.SetScanMode(ScanNullAsZero).Select("a", "b").From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.Pair).To(Equal(&pair{A: 42}))
+			})
+			It("should allocate pointers for non-NULL values", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					A *int
+					B *int
+				}
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.A).NotTo(BeNil())
+				Expect(*a.A).To(Equal(42))
+				Expect(a.B).To(BeNil())
+			})
+			It("should accept sql.Null* types", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					A sql.NullInt64
+					B sql.NullInt64
+				}
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.A).To(Equal(sql.NullInt64{Int64: 42, Valid: true}))
+				Expect(a.B.Valid).To(BeFalse())
+				var b sql.NullInt64
+				e = q.Select(Ident("b")).From("test").Into(&b)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(b.Valid).To(BeFalse())
+			})
+			It("should fail on NULLs in plain fields by default", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var b int
+				e = q.Select(Ident("b")).From("test").Into(&b)
+				Expect(e).To(HaveOccurred())
+			})
+			It("should scan NULLs as zero values in ScanNullAsZero mode", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				q.SetScanMode(ScanNullAsZero)
+				var a []struct {
+					A int
+					B int
+				}
+				e = q.Select().From("test").OrderBy("a").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(2))
+				Expect(a[0].A).To(Equal(42))
+				Expect(a[0].B).To(Equal(0))
+				Expect(a[1].B).To(Equal(2))
+				b := 57
+				e = q.Select(Ident("b")).From("test").Where(Ident("a").Eq(42)).Into(&b)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(b).To(Equal(0))
+			})
+			It("should report unmapped columns in ScanStrictColumns mode", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					A int
+				}
+				e = q.Select().From("test").ScanMode(ScanStrictColumns).Into(&a)
+				Expect(e).To(BeAssignableToTypeOf(&MappingError{}))
+				Expect(e.(*MappingError).UnmappedColumns).To(Equal([]string{"id", "b"}))
+				Expect(e.(*MappingError).UnfilledFields).To(BeEmpty())
+				var b int
+				e = q.Select(Ident("a"), Ident("b")).From("test").ScanMode(ScanStrictColumns).Into(&b)
+				Expect(e).To(BeAssignableToTypeOf(&MappingError{}))
+			})
+			It("should report unfilled fields in ScanStrictFields mode", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					A     int
+					C     int
+					Inner struct {
+						D int
+					}
+					Note string `db:"note,optional"`
+				}
+				q.SetScanMode(ScanStrictFields)
+				e = q.Select(Ident("a")).From("test").Into(&a)
+				Expect(e).To(BeAssignableToTypeOf(&MappingError{}))
+				Expect(e.(*MappingError).UnmappedColumns).To(BeEmpty())
+				Expect(e.(*MappingError).UnfilledFields).To(Equal([]string{"C", "Inner.D"}))
+				e = q.Select(Ident("a"), Alias("b", "c"), Alias("b", `"inner.d"`)).From("test").Into(&a)
+				Expect(e).NotTo(HaveOccurred())
+			})
+			It("should accept a map", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a map[string]interface{}
+				e = q.Select(Ident("a"), Ident("b")).From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(2))
+				Expect(a["a"]).To(BeEquivalentTo(42))
+				Expect(a["b"]).To(BeNil())
+			})
+			It("should accept a list of maps", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a []map[string]interface{}
+				e = q.Select(Ident("a")).From("test").OrderBy("a").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(2))
+				Expect(a[0]["a"]).To(BeEquivalentTo(42))
+				Expect(a[1]["a"]).To(BeEquivalentTo(43))
+			})
+			It("should accept a list of Rows", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a []Row
+				e = q.Select(Ident("a"), Ident("b")).From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(1))
+				Expect(a[0].Columns()).To(Equal([]string{"a", "b"}))
+				Expect(a[0].Int64("a")).To(Equal(int64(42)))
+				Expect(a[0].Float64("a")).To(Equal(42.0))
+				Expect(a[0].String("a")).To(Equal("42"))
+				Expect(a[0].IsNull("b")).To(BeTrue())
+				_, e = a[0].Int64("b")
+				Expect(e).To(HaveOccurred())
+				_, e = a[0].Int64("c")
+				Expect(e).To(HaveOccurred())
+			})
+			It("should accept a list of pointers", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type row struct {
+					A int
+					B int
+				}
+				var a []*row
+				e = q.Select().From("test").OrderBy("a").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(2))
+				Expect(*a[0]).To(Equal(row{A: 42, B: 1}))
+				Expect(*a[1]).To(Equal(row{A: 43, B: 2}))
+				var b *row
+				e = q.Select().From("test").OrderBy("a").Into(&b)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(*b).To(Equal(row{A: 42, B: 1}))
+			})
+			It("should accept a map keyed by a column", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a map[int64]int
+				e = q.Select(Ident("a"), Ident("b")).From("test").KeyBy("b").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal(map[int64]int{1: 42, 2: 43}))
+			})
+			It("should fail if only the key column is selected", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a map[int64]int64
+				e = q.Select(Ident("a")).From("test").KeyBy("a").Into(&a)
+				var mappingErr *MappingError
+				Expect(errors.As(e, &mappingErr)).To(BeTrue())
+				Expect(mappingErr.UnfilledFields).To(Equal([]string{"value"}))
+			})
+			It("should accept a map keyed by the primary key field", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				type row struct {
+					ID int `db:"id,pk"`
+					A  int
+				}
+				var a map[int]*row
+				e = q.Select().From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(HaveLen(2))
+				for id, r := range a {
+					Expect(r.ID).To(Equal(id))
+				}
+			})
+			It("should require a key column for maps", func() {
+				var a map[int]int
+				e := q.Select().From("test").Into(&a)
+				Expect(e).To(HaveOccurred())
+			})
+			It("should accept a list of arrays", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a [][2]int
+				e = q.Select(Ident("a"), Ident("b")).From("test").OrderBy("a").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal([][2]int{{42, 1}, {43, 2}}))
+			})
+			It("should accept tuple structs", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					Tuple
+					X int
+					Y int
+				}
+				e = q.Select(Ident("a"), Ident("b")).From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.X).To(Equal(42))
+				Expect(a.Y).To(Equal(1))
+			})
+			It("should use registered converters", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, NULL)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				q.RegisterConverter(money{}, moneyConverter)
+				var a struct {
+					A money
+					B *money
+				}
+				e = q.Select().From("test").Where(Args{"a": money{42}}).Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.A).To(Equal(money{42}))
+				Expect(a.B).To(BeNil())
+				var b []money
+				e = q.Select(Ident("a")).From("test").Where(Ident("a").Eq(Bind("a"))).Into(&b, Args{"a": money{42}})
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(b).To(Equal([]money{{42}}))
+			})
+			It("should use the configured name mapper", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a struct {
+					SomeValue int
+				}
+				q.SetMapper(SnakeCase)
+				e = q.Select(Alias("a", "some_value")).From("test").Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a.SomeValue).To(Equal(42))
+			})
+		})
+
+		Describe("First()", func() {
+			It("should use the state of the query it is called on", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a int
+				s := q.Select(Ident("a")).From("test").OrderBy("a")
+				e = s.First(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal(42))
+				e = s.Where(Ident("b").Eq(2)).First(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal(43))
+				e = s.Into(&a)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal(42))
+				Expect(Q(s)).To(Equal("SELECT a FROM test ORDER BY a"))
+			})
+			It("should return sql.ErrNoRows on empty results", func() {
+				testschema(db)
+				var a int
+				e := q.Select(Ident("a")).From("test").First(&a)
+				Expect(e).To(Equal(sql.ErrNoRows))
+			})
+		})
+
+		Describe("One()", func() {
+			It("should fail on more than one row", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				a := 57
+				e = q.Select(Ident("a")).From("test").One(&a)
+				Expect(e).To(Equal(ErrTooManyRows))
+				Expect(a).To(Equal(57))
+				e = q.Select(Ident("a")).From("test").Where(Ident("b").Eq(1)).One(&a)
+				Expect(e).NotTo(HaveOccurred())
+				Expect(a).To(Equal(42))
+			})
+		})
+
+		Describe("OneOrNone()", func() {
+			It("should report whether a row was found", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a int
+				found, e := q.Select(Ident("a")).From("test").Where(Ident("b").Eq(3)).OneOrNone(&a)
+				Expect(e).NotTo(HaveOccurred())
+				Expect(found).To(BeFalse())
+				found, e = q.Select(Ident("a")).From("test").Where(Ident("b").Eq(2)).OneOrNone(&a)
+				Expect(e).NotTo(HaveOccurred())
+				Expect(found).To(BeTrue())
+				Expect(a).To(Equal(43))
+				_, e = q.Select(Ident("a")).From("test").OneOrNone(&a)
+				Expect(e).To(Equal(ErrTooManyRows))
+			})
+		})
+
+		Describe("IntoColumns()", func() {
+			It("should fill parallel slices", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a []int
+				var b []string
+				e = q.Select(Ident("a"), Ident("b")).From("test").OrderBy("a").IntoColumns(&a, &b)
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal([]int{42, 43}))
+				Expect(b).To(Equal([]string{"1", "2"}))
+			})
+			It("should fill scalars from a single row", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				var a, b int
+				e = q.Select(Ident("a"), Ident("b")).From("test").Where(Ident("a").Eq(Bind("a"))).IntoColumns(&a, &b, Args{"a": 43})
+				if e != nil {
+					Fail(e.Error())
+				}
+				Expect(a).To(Equal(43))
+				Expect(b).To(Equal(2))
+			})
+			It("should not mix slices and scalars", func() {
+				var a []int
+				var b int
+				e := q.Select(Ident("a"), Ident("b")).From("test").IntoColumns(&a, &b)
+				Expect(e).To(HaveOccurred())
+			})
+		})
+
+		Describe("Iterate()", func() {
+			It("should step through the rows", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				it, e := q.Select().From("test").OrderBy("a").Iterate(context.Background())
+				if e != nil {
+					Fail(e.Error())
+				}
+				defer it.Close()
+				var rows []struct {
+					A int
+					B int
+				}
+				for it.Next() {
+					var row struct {
+						A int
+						B int
+					}
+					if e := it.Scan(&row); e != nil {
+						Fail(e.Error())
+					}
+					rows = append(rows, row)
+				}
+				Expect(it.Err()).NotTo(HaveOccurred())
+				Expect(rows).To(HaveLen(2))
+				Expect(rows[0].A).To(Equal(42))
+				Expect(rows[1].B).To(Equal(2))
+			})
+		})
+
+		Describe("Each()", func() {
+			It("should call the function for every row", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				sum := 0
+				e = q.Select(Ident("a")).From("test").Each(context.Background(), func(a *int) error {
+					sum += *a
+					return nil
+				})
+				Expect(e).NotTo(HaveOccurred())
+				Expect(sum).To(Equal(85))
+			})
+			It("should stop at the first error", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				calls := 0
+				stop := errors.New("stop")
+				e = q.Select(Ident("a")).From("test").Each(context.Background(), func(a *int) error {
+					calls++
+					return stop
+				})
+				Expect(e).To(Equal(stop))
+				Expect(calls).To(Equal(1))
+			})
+			It("should reject functions of the wrong type", func() {
+				e := q.Select().From("test").Each(context.Background(), func(a int) {})
+				Expect(e).To(HaveOccurred())
+			})
+		})
+
+		Describe("Prepare()", func() {
+			It("should execute repeatedly with different args", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				stmt, e := q.Prepare(context.Background(), q.Select(Ident("a")).From("test").Where(Ident("b").Eq(Bind("b"))))
+				Expect(e).NotTo(HaveOccurred())
+				defer stmt.Close()
+				var a int
+				Expect(stmt.Into(&a, Args{"b": 1})).To(Succeed())
+				Expect(a).To(Equal(42))
+				Expect(stmt.Into(&a, Args{"b": 2})).To(Succeed())
+				Expect(a).To(Equal(43))
+			})
+			It("should prepare a statement per slice length", func() {
+				testschema(db)
+				_, e := db.Exec("INSERT INTO test (a, b) VALUES (42, 1), (43, 2), (44, 3)")
+				if e != nil {
+					Fail(e.Error())
+				}
+				stmt, e := q.Prepare(context.Background(), q.Select(Ident("a")).From("test").Where(Ident("b").In(Bind("b"))).OrderBy(Order("a", "asc")))
+				Expect(e).NotTo(HaveOccurred())
+				defer stmt.Close()
+				var a []int
+				Expect(stmt.Into(&a, Args{"b": []int{1, 3}})).To(Succeed())
+				Expect(a).To(Equal([]int{42, 44}))
+				a = nil
+				Expect(stmt.Into(&a, Args{"b": []int{2}})).To(Succeed())
+				Expect(a).To(Equal([]int{43}))
+				a = nil
+				Expect(stmt.Into(&a, Args{"b": []int{3, 1}})).To(Succeed())
+				Expect(a).To(Equal([]int{42, 44}))
+				Expect(stmt.shapes).To(HaveLen(2))
+			})
+			It("should report binding errors eagerly", func() {
+				_, e := q.Prepare(context.Background(), q.Select().From("test").Where(Ident("b").Eq(Bind("b"))), Args{})
+				Expect(e).To(BeAssignableToTypeOf(&BindingError{}))
+			})
+			It("should fail after Close()", func() {
+				stmt, e := q.Prepare(context.Background(), q.Select().From("test"))
+				Expect(e).NotTo(HaveOccurred())
+				Expect(stmt.Close()).To(Succeed())
+				_, e = stmt.QueryContext(context.Background())
+				Expect(e).To(HaveOccurred())
+			})
+		})
+
+	})
+
+	Describe("Alias", func() {
+		It("should be an expression", func() {
+			alias := Alias(Literal(2).Mult(Literal(2)), "x")
+			eq := alias.Eq(Literal(4))
+			Expect(Q(alias)).To(Equal("(2 * 2) AS x"))
+			Expect(Q(eq)).To(Equal("x = 4"))
+		})
+	})
+
+	Describe("Col()", func() {
+		It("should be usable on identifiers", func() {
+			t := Ident("t")
+			Expect(Q(t.Col("a"))).To(Equal(`"t"."a"`))
+		})
+		It("should be usable on aliases", func() {
+			t := Alias("table", "t")
+			Expect(Q(t.Col("a"))).To(Equal(`"t"."a"`))
+		})
+		It("should support operators", func() {
+			t := Ident("t")
+			expr := t.Col("a").Eq(t.Col("b"))
+			Expect(Q(expr)).To(Equal(`"t"."a" = "t"."b"`))
+		})
+	})
+
+	Describe("Binary()", func() {
+		It("should use =", func() { Expect(Q(Literal(1).Eq(1))).To(Equal("1 = 1")) })
+		It("should use !=", func() { Expect(Q(Literal(1).NotEq(1))).To(Equal("1 != 1")) })
+		It("should use <", func() { Expect(Q(Literal(1).Less(1))).To(Equal("1 < 1")) })
+		It("should use <=", func() { Expect(Q(Literal(1).LessEq(1))).To(Equal("1 <= 1")) })
+		It("should use >", func() { Expect(Q(Literal(1).Greater(1))).To(Equal("1 > 1")) })
+		It("should use >=", func() { Expect(Q(Literal(1).GreaterEq(1))).To(Equal("1 >= 1")) })
+
+		It("should nest", func() {
+			expr1 := Literal(2).Plus(Literal(3)).Mult(Literal(5))
+			expr2 := Literal(2).Plus(Literal(3).Mult(Literal(5)))
+			Expect(Q(expr1)).To(Equal("(2 + 3) * 5"))
+			Expect(Q(expr2)).To(Equal("2 + (3 * 5)"))
+		})
+
+		It("should turn go values into expressions", func() {
+			expr := Binary(42, "=", "42")
+			sql, v := QB(expr)
+			Expect(sql).To(Equal("42 = $1"))
+			Expect(v[0].(string)).To(Equal("42"))
+		})
+		It("should accept driver values as placeholders", func() {
+			at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			sql, v := QB(Ident("x").Eq(at).And(Ident("y").Eq(1.5)))
+			Expect(sql).To(Equal("(x = $1) AND (y = $2)"))
+			Expect(v).To(Equal([]interface{}{at, 1.5}))
+		})
+		It("should reject values that neither the driver nor a converter can handle", func() {
+			_, _, err := q.SQL(Ident("x").Eq(money{42}), Args{})
+			Expect(err).To(MatchError(ContainSubstring("register a Converter")))
+			Expect(func() { Ident("x").Eq(make(chan int)) }).To(Panic())
+		})
+		It("should convert values with registered converters", func() {
+			q.RegisterConverter(money{}, moneyConverter)
+			sql, v := QB(Ident("x").Eq(Literal(money{42})))
+			Expect(sql).To(Equal("x = $1"))
+			Expect(v).To(Equal([]interface{}{int64(42)}))
+		})
+		It("should support = with nulls", func() {
+			expr := Ident("x").Eq(nil)
+			Expect(Q(expr)).To(Equal("x IS NULL"))
+		})
+		It("should support != with nulls", func() {
+			expr := Ident("x").NotEq(nil)
+			Expect(Q(expr)).To(Equal("x IS NOT NULL"))
+		})
+		It("should support nulls on the left side", func() {
+			Expect(Q(Literal(nil).Eq(Ident("x")))).To(Equal("x IS NULL"))
+			Expect(Q(Literal(nil).NotEq(Ident("x")))).To(Equal("x IS NOT NULL"))
+		})
+		It("should support nulls on both sides", func() {
+			Expect(Q(Literal(nil).Eq(nil))).To(Equal("NULL IS NULL"))
+		})
+	})
+
+	Describe("Bind()", func() {
+		It("should be mappable to values", func() {
+			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
+			sql, v, _ := q.SQL(e, Args{"myValue": 42})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE x = ($1)"))
+			Expect(v).To(HaveLen(1))
+			Expect(v[0]).To(Equal(42))
+		})
+		It("should be reusable", func() {
+			e := q.Select().From("t").Where(Bind("myValue").Eq(Bind("myValue")))
+			sql, v, _ := q.SQL(e, Args{"myValue": 42})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE ($1) = ($1)"))
+			Expect(v).To(HaveLen(1))
+			Expect(v[0]).To(Equal(42))
+		})
+		It("should play nicely with string literals", func() {
+			e := q.Select().From("t").Where(Ident("a").Eq("meh")).Where(Ident("x").Eq(Bind("myValue")))
+			sql, v, _ := q.SQL(e, Args{"myValue": 42})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = $1) AND (x = ($2))"))
+			Expect(v).To(HaveLen(2))
+			Expect(v[0]).To(Equal("meh"))
+			Expect(v[1]).To(Equal(42))
+		})
+		It("should support = with nulls", func() {
+			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
+			sql, v, _ := q.SQL(e, Args{"myValue": nil})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE x IS NULL"))
+			Expect(v).To(BeEmpty())
+		})
+		It("should support = with nulls on the left side", func() {
+			e := q.Select().From("t").Where(Bind("myValue").Eq(Ident("x")))
+			sql, v, _ := q.SQL(e, Args{"myValue": nil})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE x IS NULL"))
+			Expect(v).To(BeEmpty())
+		})
+		It("should support != with nulls on the left side", func() {
+			e := q.Select().From("t").Where(Bind("myValue").NotEq(Ident("x")))
+			sql, v, _ := q.SQL(e, Args{"myValue": nil})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE x IS NOT NULL"))
+			Expect(v).To(BeEmpty())
+		})
+		It("should render nulls outside of comparisons", func() {
+			e := q.Select(Bind("myValue")).From("t")
+			sql, v, _ := q.SQL(e, Args{"myValue": nil})
+			Expect(sql).To(Equal("SELECT NULL FROM t"))
+			Expect(v).To(BeEmpty())
+		})
+		It("should fail on unbound values", func() {
+			e := q.Select().From("t").Where(Ident("x").Eq(Bind("b"))).Where(Ident("y").Eq(Bind("a")))
+			_, _, err := q.SQL(e, Args{"c": 1})
+			var bindingErr *BindingError
+			Expect(errors.As(err, &bindingErr)).To(BeTrue())
+			Expect(bindingErr.Unbound).To(Equal([]string{"a", "b"}))
+			Expect(bindingErr.Unused).To(BeEmpty())
+		})
+		It("should fail on unbound values without args", func() {
+			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
+			_, _, err := q.SQL(e, nil)
+			Expect(err).To(BeAssignableToTypeOf(&BindingError{}))
+		})
+		It("should render unbound values as placeholders without args", func() {
+			e := q.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
+			Expect(Q(e)).To(Equal("SELECT * FROM t WHERE x = ($1)"))
+		})
+		It("should optionally fail on unused args", func() {
+			strict := NewQ(db, PostgresDialect{DialectOptions{RejectUnusedArgs: true}})
+			e := strict.Select().From("t").Where(Ident("x").Eq(Bind("myValue")))
+			_, _, err := strict.SQL(e, Args{"myValue": 1, "other": 2})
+			var bindingErr *BindingError
+			Expect(errors.As(err, &bindingErr)).To(BeTrue())
+			Expect(bindingErr.Unused).To(Equal([]string{"other"}))
+			_, _, err = strict.SQL(e, Args{"myValue": nil})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("Compile()", func() {
+		It("should record binding positions", func() {
+			e := q.Select().From("t").Where(Ident("a").Eq("x")).Where(Ident("b").In(Bind("b"))).Where(Ident("c").Eq(Bind("c")))
+			t, err := PostgresDialect{}.Compile(e, Args{"b": []int{1, 2}, "c": 3})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t.SQL).To(Equal("SELECT * FROM t WHERE ((a = $1) AND b IN ($2,$3)) AND (c = ($4))"))
+			Expect(t.Bindings).To(Equal(map[string][]int{"b": {1, 2}, "c": {3}}))
+			Expect(t.Bind(Args{"b": []int{5, 6}, "c": 7})).To(Equal([]interface{}{"x", 5, 6, 7}))
+		})
+	})
+
+	Describe("SetCacheSize()", func() {
+		It("should reuse templates for equal expressions", func() {
+			q.SetCacheSize(10)
+			build := func() Expression {
+				return q.Select().From("t").Where(Ident("a").Eq("x")).Where(Ident("b").Eq(Bind("b")))
+			}
+			sql, v, err := q.SQL(build(), Args{"b": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = $1) AND (b = ($2))"))
+			Expect(v).To(Equal([]interface{}{"x", 1}))
+			sql, v, err = q.SQL(build(), Args{"b": 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = $1) AND (b = ($2))"))
+			Expect(v).To(Equal([]interface{}{"x", 2}))
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}))
+		})
+		It("should distinguish literal values", func() {
+			q.SetCacheSize(10)
+			sql, _, _ := q.SQL(Ident("a").Eq(1), Args{})
+			Expect(sql).To(Equal("a = 1"))
+			sql, _, _ = q.SQL(Ident("a").Eq(2), Args{})
+			Expect(sql).To(Equal("a = 2"))
+			Expect(q.CacheStats().Hits).To(BeZero())
+		})
+		It("should share templates between values passed in implicit placeholders", func() {
+			q.SetCacheSize(10)
+			build := func(a string, b time.Time, c []interface{}) Expression {
+				return q.Select().From("t").Where(Ident("a").Eq(a)).Where(Ident("b").Eq(b)).Where(Ident("c").In(c))
+			}
+			t1, t2 := time.Unix(1, 0), time.Unix(2, 0)
+			sql, v, err := q.SQL(build("x", t1, []interface{}{1, 2}), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE ((a = $1) AND (b = $2)) AND c IN ($3,$4)"))
+			Expect(v).To(Equal([]interface{}{"x", t1, 1, 2}))
+			sql, v, err = q.SQL(build("y", t2, []interface{}{3, 4}), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE ((a = $1) AND (b = $2)) AND c IN ($3,$4)"))
+			Expect(v).To(Equal([]interface{}{"y", t2, 3, 4}))
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}))
+			sql, _, _ = q.SQL(build("y", t2, []interface{}{3}), Args{})
+			Expect(sql).To(Equal("SELECT * FROM t WHERE ((a = $1) AND (b = $2)) AND c IN ($3)"))
+			Expect(q.CacheStats().Size).To(Equal(2))
+		})
+		It("should not cache templates whose values cannot be told apart", func() {
+			q.SetCacheSize(10)
+			_, v, _ := q.SQL(Ident("a").Eq("x").Or(Ident("b").Eq("x")), Args{})
+			Expect(v).To(Equal([]interface{}{"x", "x"}))
+			Expect(q.CacheStats().Size).To(BeZero())
+			_, v, _ = q.SQL(Ident("a").Eq("x").Or(Ident("b").Eq("y")), Args{})
+			Expect(v).To(Equal([]interface{}{"x", "y"}))
+			_, v, _ = q.SQL(Ident("a").Eq("z").Or(Ident("b").Eq("z")), Args{})
+			Expect(v).To(Equal([]interface{}{"z", "z"}))
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 1, Misses: 2, Size: 1}))
+		})
+		It("should count a template that cannot be reused as a miss", func() {
+			q.SetCacheSize(10)
+			e := Ident("a").Eq("x")
+			q.SQL(e, Args{})
+			for _, el := range q.cache.entries {
+				entry := el.Value.(*cacheEntry)
+				entry.statics = append(entry.statics, 0)
+			}
+			_, v, err := q.SQL(e, Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal([]interface{}{"x"}))
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 0, Misses: 2, Size: 1}))
+		})
+		It("should count compilations that cannot use the cache", func() {
+			custom := NewQ(db, SyntaxDialect{Syntax: funcSyntax{quote: strings.ToUpper}}).SetCacheSize(10)
+			sql, _, err := custom.SQL(Alias("t", "x").Col("a"), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("X.A"))
+			custom.SQL(Alias("t", "x").Col("a"), Args{})
+			Expect(custom.CacheStats()).To(Equal(CacheStats{Bypasses: 2}))
+		})
+		It("should ignore the scan settings of a query", func() {
+			q.SetCacheSize(10)
+			s := q.Select().From("t")
+			q.SQL(s, Args{})
+			q.SQL(s.ScanMode(ScanStrictColumns), Args{})
+			q.SQL(s.KeyBy("id"), Args{})
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 2, Misses: 1, Size: 1}))
+		})
+		It("should distinguish binding shapes", func() {
+			q.SetCacheSize(10)
+			e := Ident("a").In(Bind("a"))
+			sql, _, _ := q.SQL(e, Args{"a": []int{1, 2}})
+			Expect(sql).To(Equal("a IN ($1,$2)"))
+			sql, _, _ = q.SQL(e, Args{"a": []int{1}})
+			Expect(sql).To(Equal("a IN ($1)"))
+			sql, v, _ := q.SQL(e, Args{"a": []int{3, 4}})
+			Expect(sql).To(Equal("a IN ($1,$2)"))
+			Expect(v).To(Equal([]interface{}{3, 4}))
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 1, Misses: 2, Size: 2}))
+		})
+		It("should evict the least recently used templates", func() {
+			q.SetCacheSize(1)
+			q.SQL(Ident("a").Eq(1), Args{})
+			q.SQL(Ident("a").Eq(2), Args{})
+			q.SQL(Ident("a").Eq(1), Args{})
+			Expect(q.CacheStats()).To(Equal(CacheStats{Hits: 0, Misses: 3, Size: 1}))
+		})
+	})
+
+	Describe("In()", func() {
+		It("should take a go value and make it into placeholders", func() {
+			s := Ident("a").In([]int{1, 2, 5})
+			sql, v := QB(s)
+			Expect(sql).To(Equal("a IN ($1,$2,$3)"))
+			Expect(v).To(HaveLen(3))
+			Expect(v[0]).To(Equal(1))
+			Expect(v[1]).To(Equal(2))
+			Expect(v[2]).To(Equal(5))
+		})
+		It("should take a binding", func() {
+			s := Ident("a").In(Bind("myArray"))
+			sql, v, _ := q.SQL(s, Args{"myArray": []string{"a", "b", "c"}})
+			Expect(sql).To(Equal("a IN ($1,$2,$3)"))
+			Expect(v).To(HaveLen(3))
+			Expect(v[0]).To(Equal("a"))
+			Expect(v[1]).To(Equal("b"))
+			Expect(v[2]).To(Equal("c"))
+		})
+		It("should render empty lists as FALSE", func() {
+			Expect(Q(Ident("a").In([]int{}))).To(Equal("FALSE"))
+			Expect(Q(Ident("a").In(nil))).To(Equal("FALSE"))
+		})
+		It("should render bindings to empty lists as FALSE", func() {
+			s := Ident("a").In(Bind("myArray"))
+			sql, v, err := q.SQL(s, Args{"myArray": []int{}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("FALSE"))
+			Expect(v).To(BeEmpty())
+			sql, v, err = q.SQL(s, Args{"myArray": nil})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("FALSE"))
+			Expect(v).To(BeEmpty())
+		})
+		It("should select nothing with an empty list", func() {
+			testschema(db)
+			_, err := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+			Expect(err).NotTo(HaveOccurred())
+			var a []int
+			err = q.Select(Ident("a")).From("test").Where(Args{"a": []int{}}).Into(&a)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a).To(BeEmpty())
+		})
+	})
+
+	Describe("NotIn()", func() {
+		It("should take a go value and make it into placeholders", func() {
+			sql, v := QB(Ident("a").NotIn([]int{1, 2}))
+			Expect(sql).To(Equal("a NOT IN ($1,$2)"))
+			Expect(v).To(Equal([]interface{}{1, 2}))
+		})
+		It("should render empty lists as TRUE", func() {
+			Expect(Q(Ident("a").NotIn([]int{}))).To(Equal("TRUE"))
+			s := Ident("a").NotIn(Bind("myArray"))
+			sql, _, err := q.SQL(s, Args{"myArray": nil})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("TRUE"))
+		})
+		It("should select everything with an empty list", func() {
+			testschema(db)
+			_, err := db.Exec("INSERT INTO test (a, b) VALUES (42, 1)")
+			Expect(err).NotTo(HaveOccurred())
+			var a []int
+			err = q.Select(Ident("a")).From("test").Where(Ident("a").NotIn(Bind("a"))).Into(&a, Args{"a": []int{}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]int{42}))
+		})
+	})
+
+	Describe("MySQLDialect", func() {
+		var my *Dbq
+		BeforeEach(func() {
+			my = NewQ(db, MySQLDialect{})
+		})
+		It("should use positional placeholders", func() {
+			e := my.Select().From("t").Where(Ident("a").Eq("x")).Where(Bind("b").Eq(Bind("b")))
+			sql, v, err := my.SQL(e, Args{"b": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = ?) AND ((?) = (?))"))
+			Expect(v).To(Equal([]interface{}{"x", 1, 1}))
+		})
+		It("should repeat slice bindings", func() {
+			e := Ident("a").In(Bind("a")).Or(Ident("b").In(Bind("a")))
+			sql, v, err := my.SQL(e, Args{"a": []int{1, 2}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("a IN (?,?) OR b IN (?,?)"))
+			Expect(v).To(Equal([]interface{}{1, 2, 1, 2}))
+		})
+		It("should report unbound bindings once", func() {
+			_, _, err := my.SQL(Bind("a").Eq(Bind("a")), Args{})
+			Expect(err).To(Equal(&BindingError{Unbound: []string{"a"}}))
+		})
+		It("should quote columns with backticks", func() {
+			t := Alias("table", "t")
+			Expect(my.SQLString(t.Col("c"))).To(Equal("`t`.`c`"))
+		})
+		It("should use CAST", func() {
+			Expect(my.SQLString(Ident("a").Cast("signed"))).To(Equal("CAST(a AS signed)"))
+		})
+		It("should put the offset into LIMIT", func() {
+			Expect(my.SQLString(my.Select().From("t").Limit(10).Offset(20))).To(Equal("SELECT * FROM t LIMIT 20, 10"))
+			Expect(my.SQLString(my.Select().From("t").Limit(10))).To(Equal("SELECT * FROM t LIMIT 10"))
+			Expect(my.SQLString(my.Select().From("t").Offset(20))).To(Equal("SELECT * FROM t LIMIT 20, 18446744073709551615"))
+		})
+		It("should reject FULL OUTER JOIN", func() {
+			_, err := my.SQLString(my.Select().From("t1", OuterJoin("t2", Using(Ident("c")))))
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject ORDER BY in aggregates other than GROUP_CONCAT", func() {
+			_, err := my.SQLString(AggFunc("json_arrayagg", Ident("x"), OrderBy(Order("x", "asc"))))
+			Expect(err).To(HaveOccurred())
+			Expect(my.SQLString(AggFunc("group_concat", Ident("x"), OrderBy(Order("x", "asc"))))).To(Equal("group_concat(x ORDER BY x ASC)"))
+		})
+		It("should render nested expressions with its own syntax", func() {
+			sub := my.Select(Ident("a").Cast("char")).From("t").Limit(1)
+			Expect(my.SQLString(my.Select(Alias(sub, "x")).From("u"))).To(Equal("SELECT (SELECT CAST(a AS char) FROM t LIMIT 1) AS x FROM u"))
+		})
+	})
+
+	Describe("SQLiteDialect", func() {
+		var lite *Dbq
+		BeforeEach(func() {
+			conn, err := sql.Open("sqlite3", ":memory:")
+			Expect(err).NotTo(HaveOccurred())
+			conn.SetMaxOpenConns(1) // every connection gets its own in-memory database
+			exec(conn, "CREATE TABLE test ( id integer primary key, a integer, b text )")
+			exec(conn, "INSERT INTO test (a, b) VALUES (42, 'x'), (43, 'y'), (44, NULL)")
+			lite = NewQ(conn, SQLiteDialect{})
+		})
+		AfterEach(func() {
+			lite.DB.Close()
+		})
+		It("should use numbered placeholders", func() {
+			e := lite.Select().From("t").Where(Ident("a").Eq("x")).Where(Bind("b").Eq(Bind("b")))
+			sql, v, err := lite.SQL(e, Args{"b": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = ?1) AND ((?2) = (?2))"))
+			Expect(v).To(Equal([]interface{}{"x", 1}))
+		})
+		It("should quote columns with double quotes", func() {
+			t := Alias("table", "t")
+			Expect(lite.SQLString(t.Col("c"))).To(Equal(`"t"."c"`))
+		})
+		It("should use CAST", func() {
+			Expect(lite.SQLString(Ident("a").Cast("text"))).To(Equal("CAST(a AS text)"))
+		})
+		It("should allow OFFSET without LIMIT", func() {
+			Expect(lite.SQLString(lite.Select().From("t").Offset(20))).To(Equal("SELECT * FROM t LIMIT -1 OFFSET 20"))
+		})
+		It("should run queries", func() {
+			var a []int
+			e := lite.Select(Ident("a")).From("test").Where(Ident("a").In(Bind("a"))).OrderBy(Order("a", "desc")).Offset(1).Into(&a, Args{"a": []int{42, 43, 44}})
+			Expect(e).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]int{43, 42}))
+		})
+		It("should run queries with NULL bindings", func() {
+			var a int
+			e := lite.Select(Ident("a")).From("test").Where(Ident("b").Eq(Bind("b"))).Into(&a, Args{"b": nil})
+			Expect(e).NotTo(HaveOccurred())
+			Expect(a).To(Equal(44))
+		})
+		It("should run emulated comparisons", func() {
+			emulated := NewQ(lite.DB, SyntaxDialect{Syntax: DefaultSyntax{}})
+			var a []int
+			e := emulated.Select(Ident("a")).From("test").Where(Ident("b").IsNotDistinctFrom(Bind("b"))).Into(&a, Args{"b": nil})
+			Expect(e).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]int{44}))
+			a = nil
+			e = emulated.Select(Ident("a")).From("test").Where(Ident("b").IsDistinctFrom(Bind("b"))).OrderBy("a").Into(&a, Args{"b": "x"})
+			Expect(e).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]int{43, 44}))
+			a = nil
+			e = emulated.Select(Ident("a")).From("test").Where(Ident("b").ILike("X")).Into(&a)
+			Expect(e).NotTo(HaveOccurred())
+			Expect(a).To(Equal([]int{42}))
+		})
+		It("should run prepared queries", func() {
+			stmt, e := lite.Prepare(context.Background(), lite.Select(Ident("a")).From("test").Where(Ident("b").Eq(Bind("b"))))
+			Expect(e).NotTo(HaveOccurred())
+			defer stmt.Close()
+			var a int
+			Expect(stmt.Into(&a, Args{"b": "y"})).To(Succeed())
+			Expect(a).To(Equal(43))
+		})
+		It("should run upserts with RETURNING", func() {
+			var rows []struct {
+				ID int
+				B  string
+			}
+			upsert := lite.InsertInto("test", "id", "b").Values(1, "z").Values(9, "w").OnConflict("id").DoUpdate("b", Excluded("b")).Returning("id", "b")
+			Expect(upsert.Into(&rows)).To(Succeed())
+			Expect(rows).To(HaveLen(2))
+			Expect(rows[0].B).To(Equal("z"))
+			Expect(rows[1].B).To(Equal("w"))
+			copied := lite.InsertInto("test", "id", "a").Select(lite.Select(Ident("id").Plus(100), "a").From("test")).OnConflict().Returning("id")
+			Expect(lite.SQLString(copied)).To(Equal("INSERT INTO test (id, a) SELECT id + 100, a FROM test WHERE 1 ON CONFLICT DO NOTHING RETURNING id"))
+			var ids []int
+			Expect(copied.Into(&ids)).To(Succeed())
+			Expect(ids).To(HaveLen(4))
+		})
+		It("should depend on the version of SQLite", func() {
+			Expect(SQLiteDialect{}.Capabilities().Has(CapReturning | CapOnConflict | CapFullJoin)).To(BeTrue())
+			Expect(SQLiteDialect{Version: 3035000}.Capabilities().Has(CapReturning | CapOnConflict)).To(BeTrue())
+			Expect(SQLiteDialect{Version: 3035000}.Capabilities().Has(CapFullJoin)).To(BeFalse())
+			old := NewQ(lite.DB, SQLiteDialect{Version: 3031001})
+			var unsupported *UnsupportedFeatureError
+			_, err := old.SQLString(old.DeleteFrom("test").Returning("id"))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapReturning))
+			_, err = old.SQLString(old.InsertInto("test", "a").Values(1).OnConflict().DoUpdate("a", 2))
+			Expect(err).To(MatchError("ON CONFLICT DO UPDATE needs a conflict target before SQLite 3.35"))
+			Expect(old.SQLString(old.InsertInto("test", "id").Values(1).OnConflict("id").DoUpdate("a", 2))).To(Equal("INSERT INTO test (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET a = 2"))
+			ancient := NewQ(lite.DB, SQLiteDialect{Version: 3022000})
+			_, err = ancient.SQLString(ancient.InsertInto("test", "a").Values(1).OnConflict())
+			Expect(err).To(MatchError("ON CONFLICT is not supported by this dialect"))
+		})
+	})
+
+	Describe("MSSQLDialect", func() {
+		var ms *Dbq
+		BeforeEach(func() {
+			ms = NewQ(db, MSSQLDialect{})
+		})
+		It("should use numbered parameters", func() {
+			e := ms.Select().From("t").Where(Ident("a").Eq("x")).Where(Bind("b").Eq(Bind("b")))
+			sql, v, err := ms.SQL(e, Args{"b": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT * FROM t WHERE (a = @p1) AND ((@p2) = (@p2))"))
+			Expect(v).To(Equal([]interface{}{"x", 1}))
+		})
+		It("should quote columns with brackets", func() {
+			t := Alias("table", "t")
+			Expect(ms.SQLString(t.Col("c]"))).To(Equal("[t].[c]]]"))
+		})
+		It("should use CAST", func() {
+			Expect(ms.SQLString(Ident("a").Cast("int"))).To(Equal("CAST(a AS int)"))
+		})
+		It("should use TOP without an offset", func() {
+			Expect(ms.SQLString(ms.Select(Distinct{}, "a").From("t").Limit(10))).To(Equal("SELECT DISTINCT TOP 10 a FROM t"))
+		})
+		It("should use OFFSET and FETCH with an offset", func() {
+			e := ms.Select().From("t").OrderBy(Order("a", "asc")).Limit(10).Offset(20)
+			Expect(ms.SQLString(e)).To(Equal("SELECT * FROM t ORDER BY a ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY"))
+			e = ms.Select().From("t").Offset(20)
+			Expect(ms.SQLString(e)).To(Equal("SELECT * FROM t ORDER BY (SELECT NULL) OFFSET 20 ROWS"))
+		})
+		It("should render constant conditions as comparisons", func() {
+			Expect(ms.SQLString(ms.Select().From("t").Where(Ident("a").In([]int{})))).To(Equal("SELECT * FROM t WHERE (1 = 0)"))
+		})
+		It("should reject USING", func() {
+			_, err := ms.SQLString(ms.Select().From("t1", Join("t2", Using(Ident("c")))))
+			Expect(err).To(HaveOccurred())
+		})
+		It("should order aggregates WITHIN GROUP", func() {
+			e := AggFunc("string_agg", Ident("x"), Literal(","), OrderBy(Order("x", "asc")))
+			sql, _, err := ms.SQL(e, Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("string_agg(x, @p1) WITHIN GROUP (ORDER BY x ASC)"))
+		})
+		It("should write RETURNING as OUTPUT", func() {
+			sql, v, err := ms.SQL(ms.InsertInto("t", "a", "b").Values(1, "x").Returning("id", Ident("a").Plus(1)), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("INSERT INTO t (a, b) OUTPUT INSERTED.[id], INSERTED.[a] + 1 VALUES (1, @p1)"))
+			Expect(v).To(Equal([]interface{}{"x"}))
+			Expect(ms.SQLString(ms.Update("t").Set("a", 1).Where(Ident("id").Eq(2)).Returning("id", "a"))).To(Equal("UPDATE t SET a = 1 OUTPUT INSERTED.[id], INSERTED.[a] WHERE id = 2"))
+			Expect(ms.SQLString(ms.DeleteFrom("t").Where(Ident("id").Eq(2)).Returning(Alias(Ident("a"), "old_a")))).To(Equal("DELETE FROM t OUTPUT DELETED.[a] AS old_a WHERE id = 2"))
+			Expect(ms.SQLString(ms.DeleteFrom("t").Returning("id"))).To(Equal("DELETE FROM t OUTPUT DELETED.[id]"))
+			pretty := NewQ(db, MSSQLDialect{DialectOptions{Pretty: true}})
+			Expect(pretty.SQLString(pretty.InsertInto("t", "a").Select(pretty.Select("a").From("u")).Returning("id"))).To(Equal("INSERT INTO t (a)\nOUTPUT INSERTED.[id]\nSELECT a\nFROM u"))
+			_, err = ms.SQLString(ms.InsertInto("t", "a").Values(1).OnConflict())
+			Expect(err).To(MatchError("ON CONFLICT is not supported by this dialect"))
+			Expect(MSSQLDialect{}.Capabilities().Has(CapReturning)).To(BeTrue())
+		})
+		It("should leave out ORDER BY in subqueries without a row limit", func() {
+			sub := ms.Select("a").From("u").OrderBy("a")
+			Expect(ms.SQLString(sub)).To(Equal("SELECT a FROM u ORDER BY a"))
+			Expect(ms.SQLString(ms.Select().From("t").Where(Ident("a").In(sub)).OrderBy("b"))).To(Equal("SELECT * FROM t WHERE a IN (SELECT a FROM u) ORDER BY b"))
+			Expect(ms.SQLString(ms.Select().From(Alias(sub.Limit(5), "s")))).To(Equal("SELECT * FROM (SELECT TOP 5 a FROM u ORDER BY a) AS s"))
+			Expect(ms.SQLString(ms.DeleteFrom("t").Where(Ident("a").In(sub)))).To(Equal("DELETE FROM t WHERE a IN (SELECT a FROM u)"))
+		})
+	})
+
+	Describe("SyntaxDialect", func() {
+		It("should use the overridden parts of the syntax", func() {
+			custom := NewQ(db, SyntaxDialect{Syntax: bracketSyntax{}})
+			t := Alias("table", "t")
+			sql, v, err := custom.SQL(custom.Select(t.Col("c").Cast("int")).From(t).Where(t.Col("c").Eq(Bind("c"))).Limit(1), Args{"c": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT ([t].[c])::int FROM table AS t WHERE [t].[c] = ($1) LIMIT 1"))
+			Expect(v).To(Equal([]interface{}{1}))
+		})
+		It("should default to standard syntax", func() {
+			custom := NewQ(db, SyntaxDialect{Syntax: DefaultSyntax{}})
+			sql, v, err := custom.SQL(Ident("a").Cast("int").Eq(Bind("a")).Or(Ident("b").Eq(Bind("a"))), Args{"a": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("(CAST(a AS int) = (?)) OR (b = (?))"))
+			Expect(v).To(Equal([]interface{}{1, 1}))
+		})
+		It("should be cached", func() {
+			custom := NewQ(db, SyntaxDialect{Syntax: DefaultSyntax{}}).SetCacheSize(10)
+			custom.SQL(Ident("a").Eq("x"), Args{})
+			sql, v, err := custom.SQL(Ident("a").Eq("y"), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("a = ?"))
+			Expect(v).To(Equal([]interface{}{"y"}))
+			Expect(custom.CacheStats()).To(Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}))
+		})
+	})
+
+	Describe("Dialect", func() {
+		It("should only require SQL() and SQLString()", func() {
+			minimal := NewQ(db, minimalDialect{}).SetCacheSize(10)
+			sql, v, err := minimal.SQL(Ident("a").Eq("x"), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("a = $1"))
+			Expect(v).To(Equal([]interface{}{"x"}))
+			Expect(minimal.CacheStats().Misses).To(BeZero())
+			_, err = minimal.Prepare(context.Background(), Ident("a").Eq("x"))
+			Expect(err).To(MatchError(ContainSubstring("cannot compile templates")))
+			_, err = minimal.Interpolate(Ident("a").Eq("x"), Args{})
+			Expect(err).To(MatchError(ContainSubstring("cannot interpolate values")))
+		})
+	})
+
+	Describe("Parse()", func() {
+		It("should quote quoted identifiers for the dialect", func() {
+			s, err := q.Parse(`SELECT u."user id", "Stats".n AS "Total", s.* FROM public."Users" u JOIN "Stats" s ON s.uid = u."user id" ORDER BY "Total"`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(s)).To(Equal(`SELECT u."user id", "Stats".n AS "Total", s.* FROM public."Users" AS u INNER JOIN "Stats" AS s ON (s.uid = u."user id") ORDER BY "Total"`))
+			Expect(MySQLDialect{}.SQLString(s)).To(Equal("SELECT u.`user id`, `Stats`.n AS `Total`, s.* FROM public.`Users` AS u INNER JOIN `Stats` AS s ON (s.uid = u.`user id`) ORDER BY `Total`"))
+			Expect(MSSQLDialect{}.SQLString(s)).To(Equal("SELECT u.[user id], [Stats].n AS [Total], s.* FROM public.[Users] AS u INNER JOIN [Stats] AS s ON (s.uid = u.[user id]) ORDER BY [Total]"))
+			e, err := q.ParseStatement(`UPDATE "Users" SET "user id" = 1 RETURNING "user id"`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(MSSQLDialect{}.SQLString(e)).To(Equal("UPDATE [Users] SET [user id] = 1 OUTPUT INSERTED.[user id]"))
+		})
+		It("should parse a SELECT statement", func() {
+			s, err := q.Parse(`SELECT DISTINCT u.id, count(*) AS n
+				FROM users u LEFT JOIN teams AS t ON t.id = u.team_id
+				WHERE u.age BETWEEN 18 AND 65 AND u.name LIKE 'a%' -- comment
+				GROUP BY u.id ORDER BY n DESC LIMIT 10 OFFSET 5;`)
+			Expect(err).NotTo(HaveOccurred())
+			sql, v, err := q.SQL(s, Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT DISTINCT u.id, count(*) AS n FROM users AS u LEFT JOIN teams AS t ON (t.id = u.team_id) WHERE ((u.age >= 18) AND (u.age <= 65)) AND (u.name LIKE $1) GROUP BY u.id ORDER BY n DESC LIMIT 10 OFFSET 5"))
+			Expect(v).To(Equal([]interface{}{"a%"}))
+		})
+		It("should parse joins and subqueries", func() {
+			s, err := q.Parse(`select * from a, b cross join c join (select x from d) s using (x, y) where a.v::numeric(10,2) > 1 and exists (select 1 from e where e.id = a.id)`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(s)).To(Equal("SELECT * FROM a , b CROSS JOIN c INNER JOIN (SELECT x FROM d) AS s USING (x,y) WHERE ((a.v)::numeric(10,2) > 1) AND EXISTS(SELECT 1 FROM e WHERE e.id = a.id)"))
+		})
+		It("should parse functions and windows", func() {
+			s, err := q.Parse(`SELECT "Full Name", row_number() OVER (PARTITION BY dept ORDER BY salary DESC), string_agg(DISTINCT name, ',' ORDER BY name) FROM emp`)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(s)).To(Equal(`SELECT "Full Name", row_number() OVER (PARTITION BY dept ORDER BY salary DESC), string_agg(DISTINCT name, $1 ORDER BY name) FROM emp`))
+		})
+		It("should turn parameters into bindings, and compose with builder methods", func() {
+			s, err := q.Parse("SELECT a FROM test WHERE id IN ($1, :other)")
+			Expect(err).NotTo(HaveOccurred())
+			s = s.Where(Ident("b").NotEq(Bind("b")))
+			sql, v, err := q.SQL(s, Args{"$1": 42, "other": 43, "b": "y"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT a FROM test WHERE id IN ($1,$2) AND (b != ($3))"))
+			Expect(v).To(Equal([]interface{}{42, 43, "y"}))
+			testschema(db)
+			exec(db, "INSERT INTO test (id, a, b) VALUES (42, 1, 'x'), (43, 2, 'y')")
+			var a []int
+			Expect(s.Into(&a, Args{"$1": 42, "other": 43, "b": "y"})).To(Succeed())
+			Expect(a).To(Equal([]int{1}))
+		})
+		It("should round-trip through other dialects", func() {
+			s, err := q.Parse("SELECT a::int FROM t WHERE b ILIKE 'x%' LIMIT 5")
+			Expect(err).NotTo(HaveOccurred())
+			ms := NewQ(db, MSSQLDialect{})
+			sql, err := ms.SQLString(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("SELECT TOP 5 CAST(a AS int) FROM t WHERE LOWER(b) LIKE LOWER(@p1)"))
+		})
+		It("should keep scalar subqueries in parentheses", func() {
+			s, err := q.Parse("SELECT (SELECT 1), (SELECT max(id) FROM u) AS m FROM t")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(s)).To(Equal("SELECT (SELECT 1), (SELECT max(id) FROM u) AS m FROM t"))
+			again, err := q.Parse(Q(s))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(again)).To(Equal(Q(s)))
+		})
+		It("should write NOT LIKE and NOT ILIKE so that other dialects can emulate them", func() {
+			e, err := q.ParseExpr("a NOT ILIKE 'x%' AND b NOT LIKE 'y%'")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("NOT(a ILIKE $1) AND NOT(b LIKE $2)"))
+			sql, err := NewQ(db, MySQLDialect{}).SQLString(e)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("NOT(LOWER(a) LIKE LOWER(?)) AND NOT(b LIKE ?)"))
+		})
+		It("should accept join keywords as function names", func() {
+			s, err := q.Parse("SELECT left(name, 3), RIGHT(name, 1) FROM t LEFT JOIN u USING (id)")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(s)).To(Equal("SELECT left(name, 3), RIGHT(name, 1) FROM t LEFT JOIN u USING (id)"))
+		})
+		It("should keep expressions in IN lists", func() {
+			e, err := q.ParseExpr("a IN (b, 1 + 2, 'x')")
+			Expect(err).NotTo(HaveOccurred())
+			sql, v := QB(e)
+			Expect(sql).To(Equal("a IN (b,1 + 2,$1)"))
+			Expect(v).To(Equal([]interface{}{"x"}))
+			sql, v = QB(Ident("a").In([]interface{}{"b", 1}))
+			Expect(sql).To(Equal("a IN ($1,$2)"))
+			Expect(v).To(Equal([]interface{}{"b", 1}))
+		})
+		It("should follow the operator precedence of PostgreSQL", func() {
+			e, err := q.ParseExpr("a + b * c = 1 OR NOT d IS NULL AND x <> y || z")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("((a + (b * c)) = 1) OR (NOT(d IS NULL) AND (x <> (y || z)))"))
+		})
+		It("should report errors with their position", func() {
+			_, err := q.Parse("SELECT a,\n  FROM t")
+			Expect(err).To(MatchError(`syntax error at line 2, column 3: unexpected "FROM"`))
+			_, err = q.Parse("SELECT a FROM t HAVING count(*) > 1")
+			Expect(err).To(MatchError("syntax error at line 1, column 17: HAVING is not supported"))
+			_, err = q.Parse("INSERT INTO t VALUES (1)")
+			var parseErr *ParseError
+			Expect(errors.As(err, &parseErr)).To(BeTrue())
+			Expect(parseErr.Message).To(Equal(`expected SELECT, found "INSERT"; use ParseStatement() for other statements`))
+		})
+	})
+
+	Describe("ParseStatement()", func() {
+		It("should parse INSERT statements", func() {
+			e, err := q.ParseStatement("INSERT INTO test (a, b) VALUES (1, $1), (2, :b);")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e).To(BeAssignableToTypeOf(&InsertQuery{}))
+			Expect(Q(e)).To(Equal("INSERT INTO test (a, b) VALUES (1, ($1)), (2, ($2))"))
+			e, err = q.ParseStatement("insert into archive select * from test where id < 10")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("INSERT INTO archive SELECT * FROM test WHERE id < 10"))
+		})
+		It("should parse UPDATE and DELETE statements, and compose with builder methods", func() {
+			e, err := q.ParseStatement("UPDATE test t SET a = t.a + 1, b = NULL WHERE t.id = $1")
+			Expect(err).NotTo(HaveOccurred())
+			update := e.(*UpdateQuery).Where(Ident("t.b").Greater(0))
+			Expect(Q(update)).To(Equal("UPDATE test AS t SET a = (t.a + 1), b = NULL WHERE (t.id = ($1)) AND (t.b > 0)"))
+			e, err = q.ParseStatement("DELETE FROM test WHERE a IN (SELECT a FROM other)")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("DELETE FROM test WHERE a IN (SELECT a FROM other)"))
+			again, err := q.ParseStatement(Q(e))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(again)).To(Equal(Q(e)))
+		})
+		It("should parse RETURNING and ON CONFLICT", func() {
+			e, err := q.ParseStatement("INSERT INTO test (id, a) VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET a = excluded.a, b = 0 RETURNING id, a AS x")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("INSERT INTO test (id, a) VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET a = excluded.a, b = 0 RETURNING id, a AS x"))
+			e, err = q.ParseStatement("insert into test (a) values (1) on conflict do nothing")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("INSERT INTO test (a) VALUES (1) ON CONFLICT DO NOTHING"))
+			e, err = q.ParseStatement("UPDATE test SET a = 1 WHERE id = 2 RETURNING a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("UPDATE test SET a = 1 WHERE id = 2 RETURNING a"))
+			e, err = q.ParseStatement("DELETE FROM test RETURNING id")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(Q(e)).To(Equal("DELETE FROM test RETURNING id"))
+		})
+		It("should fail to serialize RETURNING for dialects without it", func() {
+			my := NewQ(db, MySQLDialect{})
+			e, err := my.ParseStatement("DELETE FROM test WHERE id = 1 RETURNING id")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = my.SQLString(e)
+			var unsupported *UnsupportedFeatureError
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapReturning))
+			Expect(err).To(MatchError("RETURNING is not supported by this dialect"))
+		})
+		It("should reject what dbq cannot represent", func() {
+			_, err := q.ParseStatement("INSERT INTO t (a) VALUES (1) RETURNING *")
+			Expect(err).To(MatchError(ContainSubstring("RETURNING * is not supported")))
+			_, err = q.ParseStatement("INSERT INTO t (a) VALUES (1) ON CONFLICT ON CONSTRAINT t_a DO NOTHING")
+			Expect(err).To(MatchError(ContainSubstring("ON is not supported")))
+			_, err = q.ParseStatement("UPDATE t SET a = u.a FROM u WHERE u.id = t.id")
+			Expect(err).To(MatchError(ContainSubstring("FROM is not supported")))
+			_, err = q.ParseStatement("TRUNCATE t")
+			Expect(err).To(MatchError(ContainSubstring(`expected SELECT, INSERT, UPDATE or DELETE, found "TRUNCATE"`)))
+		})
+	})
+
+	Describe("InsertInto(), Update() and DeleteFrom()", func() {
+		It("should build statements", func() {
+			sql, v, err := q.SQL(q.InsertInto("test", "a", "b").Values(1, "x").Values(Bind("a"), nil), Args{"a": 2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("INSERT INTO test (a, b) VALUES (1, $1), (($2), NULL)"))
+			Expect(v).To(Equal([]interface{}{"x", 2}))
+			Expect(Q(q.InsertInto(Alias("test", "t")).Select(q.Select("a", "b").From("other")))).To(Equal("INSERT INTO test AS t SELECT a, b FROM other"))
+			sql, v = QB(q.Update("test").Set("a", Ident("a").Plus(1)).Set("b", "y").Where(Args{"id": []int{1, 2}}))
+			Expect(sql).To(Equal("UPDATE test SET a = (a + 1), b = $1 WHERE id IN ($2,$3)"))
+			Expect(v).To(Equal([]interface{}{"y", 1, 2}))
+			Expect(Q(q.DeleteFrom("test").Where(Ident("a").Eq(1)))).To(Equal("DELETE FROM test WHERE a = 1"))
+			Expect(Q(q.DeleteFrom("test"))).To(Equal("DELETE FROM test"))
+		})
+		It("should add RETURNING and ON CONFLICT clauses", func() {
+			Expect(Q(q.InsertInto("test", "a").Values(1).OnConflict().Returning("id"))).To(Equal("INSERT INTO test (a) VALUES (1) ON CONFLICT DO NOTHING RETURNING id"))
+			sql, v := QB(q.InsertInto("test", "id", "a").Values(1, 2).OnConflict("id").DoUpdate("a", Excluded("a")).DoUpdate("b", "x"))
+			Expect(sql).To(Equal(`INSERT INTO test (id, a) VALUES (1, 2) ON CONFLICT (id) DO UPDATE SET a = "excluded"."a", b = $1`))
+			Expect(v).To(Equal([]interface{}{"x"}))
+			Expect(Q(q.Update("test").Set("a", 1).Where(Ident("id").Eq(2)).Returning("id", Ident("a").Plus(1)))).To(Equal("UPDATE test SET a = 1 WHERE id = 2 RETURNING id, a + 1"))
+			Expect(Q(q.DeleteFrom("test").Returning("id"))).To(Equal("DELETE FROM test RETURNING id"))
+			Expect(func() { q.InsertInto("test", "a").Values(1).DoUpdate("a", 2) }).To(Panic())
+		})
+		It("should require RETURNING and ON CONFLICT", func() {
+			my := NewQ(db, MySQLDialect{})
+			var unsupported *UnsupportedFeatureError
+			_, err := my.SQLString(my.DeleteFrom("test").Returning("id"))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapReturning))
+			_, err = my.SQLString(my.InsertInto("test", "a").Values(1).OnConflict("a"))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapOnConflict))
+			Expect(PostgresDialect{}.Capabilities().Has(CapReturning | CapOnConflict)).To(BeTrue())
+			Expect(MySQLDialect{}.Capabilities().Has(CapReturning)).To(BeFalse())
+		})
+		It("should reject incomplete statements", func() {
+			_, err := q.SQLString(q.InsertInto("test", "a"))
+			Expect(err).To(MatchError("an INSERT statement needs values or a query"))
+			_, err = q.SQLString(q.Update("test"))
+			Expect(err).To(MatchError("an UPDATE statement needs at least one column to set"))
+		})
+		It("should write every clause on its own line if Pretty", func() {
+			pretty := NewQ(db, PostgresDialect{DialectOptions{Pretty: true}})
+			sql, err := pretty.SQLString(pretty.Update("test").Set("a", 1).Where(Ident("b").Eq(2)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("UPDATE test\nSET a = 1\nWHERE b = 2"))
+		})
+		It("should execute statements", func() {
+			testschema(db)
+			_, err := q.InsertInto("test", "a", "b").Values(1, 10).Values(2, 20).Values(3, 30).Exec()
+			Expect(err).NotTo(HaveOccurred())
+			res, err := q.Update("test").Set("b", Bind("b")).Where(Ident("a").GreaterEq(2)).Exec(Args{"b": 0})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.RowsAffected()).To(BeEquivalentTo(2))
+			res, err = q.DeleteFrom("test").Where(Args{"b": 0}).ExecContext(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.RowsAffected()).To(BeEquivalentTo(2))
+			var b []int
+			Expect(q.Select("b").From("test").Into(&b)).To(Succeed())
+			Expect(b).To(Equal([]int{10}))
+		})
+		It("should read the rows of RETURNING", func() {
+			testschema(db)
+			type row struct {
+				ID int
+				B  int
+			}
+			var inserted []row
+			Expect(q.InsertInto("test", "id", "b").Values(1, 10).Values(2, 20).Returning("id", "b").Into(&inserted)).To(Succeed())
+			Expect(inserted).To(Equal([]row{{1, 10}, {2, 20}}))
+			var upserted row
+			upsert := q.InsertInto("test", "id", "b").Values(2, 5).OnConflict("id").DoUpdate("b", Ident("test").Col("b").Plus(Excluded("b"))).Returning("id", "b")
+			Expect(upsert.Into(&upserted)).To(Succeed())
+			Expect(upserted).To(Equal(row{2, 25}))
+			var deleted []int
+			Expect(q.DeleteFrom("test").Where(Ident("b").Less(Bind("b"))).Returning("id").Into(&deleted, Args{"b": 20})).To(Succeed())
+			Expect(deleted).To(Equal([]int{1}))
+			var none []row
+			Expect(q.InsertInto("test", "id", "b").Values(2, 0).OnConflict().Returning("id", "b").Into(&none)).To(Succeed())
+			Expect(none).To(BeEmpty())
+		})
+		It("should be rewritten like queries", func() {
+			update := q.Update("orders").Set("status", "done").Where(Ident("id").Eq(Bind("id")))
+			scoped := Rewrite(update, func(n Node) Node {
+				if u, ok := n.(*UpdateExpr); ok {
+					return u.Where(Ident("tenant").Eq(Bind("tenant")))
+				}
+				return n
+			})
+			Expect(scoped).To(BeAssignableToTypeOf(&UpdateQuery{}))
+			Expect(Q(scoped.(*UpdateQuery))).To(Equal("UPDATE orders SET status = $1 WHERE (id = ($2)) AND (tenant = ($3))"))
+			Expect(Q(update)).To(Equal("UPDATE orders SET status = $1 WHERE id = ($2)"))
+		})
+	})
+
+	Describe("Walk()", func() {
+		It("should visit every node", func() {
+			e := q.Select("a").From("t1", Join(Alias(q.Select().From("t2"), "s"), On(Ident("a").Eq(Ident("b"))))).Where(Ident("c").In(Bind("c")))
+			idents := []string{}
+			stars := 0
+			Walk(e, func(n Node) bool {
+				switch n := n.(type) {
+				case Identifier:
+					idents = append(idents, string(n))
+				case *SelectExpr:
+					if len(n.Columns()) == 0 {
+						stars++
+					}
+				}
+				return true
+			})
+			Expect(idents).To(Equal([]string{"a", "t1", "t2", "a", "b", "c"}))
+			Expect(stars).To(Equal(1))
+		})
+		It("should skip the children of a node if asked to", func() {
+			e := Ident("a").Eq(Func("f", Ident("b")))
+			visited := 0
+			Walk(e, func(n Node) bool {
+				visited++
+				_, isFunc := n.(*FuncExpr)
+				return !isFunc
+			})
+			Expect(visited).To(Equal(3))
+		})
+	})
+
+	Describe("Rewrite()", func() {
+		It("should inject conditions into every query", func() {
+			e := q.Select().From("orders").Where(Ident("customer").In(q.Select("id").From("customers")))
+			scoped := e.Rewrite(func(n Node) Node {
+				if s, ok := n.(*SelectExpr); ok {
+					return s.Where(Ident("tenant").Eq(Bind("tenant")))
+				}
+				return n
+			})
+			Expect(Q(scoped)).To(Equal("SELECT * FROM orders WHERE customer IN (SELECT id FROM customers WHERE tenant = ($1)) AND (tenant = ($1))"))
+			Expect(Q(e)).To(Equal("SELECT * FROM orders WHERE customer IN (SELECT id FROM customers)"))
+			sql, v, err := q.SQL(scoped, Args{"tenant": 7})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(HavePrefix("SELECT * FROM orders"))
+			Expect(v).To(Equal([]interface{}{7}))
+		})
+		It("should rename tables", func() {
+			e := q.Select().From("t1", Join("t2", Using(Ident("id")))).Where(Ident("x").Eq(1))
+			renamed := Rewrite(e, func(n Node) Node {
+				if id, ok := n.(Identifier); ok && (id == "t1" || id == "t2") {
+					return Ident("archive_" + string(id))
+				}
+				return n
+			})
+			Expect(Q(renamed.(Expression))).To(Equal("SELECT * FROM archive_t1 INNER JOIN archive_t2 USING (id) WHERE x = 1"))
+		})
+		It("should rename the tables of columns", func() {
+			t1 := Ident("t1")
+			e := q.Select(t1.Col("a")).From(t1).Where(t1.Col("b").Eq(Ident("c")))
+			var tables []string
+			Walk(e, func(n Node) bool {
+				if t, ok := n.(TableName); ok {
+					tables = append(tables, t.Table.Name())
+				}
+				return true
+			})
+			Expect(tables).To(Equal([]string{"t1", "t1"}))
+			renamed := e.Rewrite(func(n Node) Node {
+				switch n := n.(type) {
+				case Identifier:
+					if n == "t1" {
+						return Identifier("t2")
+					}
+				case TableName:
+					if n.Table.Name() == "t1" {
+						return TableName{Ident("t2")}
+					}
+				}
+				return n
+			})
+			Expect(Q(renamed)).To(Equal(`SELECT "t2"."a" FROM t2 WHERE "t2"."b" = c`))
+			Expect(Q(e)).To(Equal(`SELECT "t1"."a" FROM t1 WHERE "t1"."b" = c`))
+		})
+		It("should share the unchanged parts", func() {
+			e := Ident("a").Eq(Ident("b")).And(Ident("c"))
+			Expect(Rewrite(e, func(n Node) Node { return n })).To(BeIdenticalTo(e))
+			op := Rewrite(e, func(n Node) Node {
+				if n == Identifier("c") {
+					return Identifier("d")
+				}
+				return n
+			}).(Expression)
+			Expect(Q(op)).To(Equal("(a = b) AND d"))
+			Expect(unwrap(op).(*BinaryOp).Left()).To(BeIdenticalTo(unwrap(e).(*BinaryOp).Left()))
+		})
+	})
+
+	Describe("Pretty", func() {
+		It("should write each clause on its own line and indent subqueries", func() {
+			pretty := NewQ(db, PostgresDialect{DialectOptions{Pretty: true}})
+			sub := pretty.Select("id").From("u").Where(Ident("active").Eq(Bind("active")))
+			e := pretty.Select("a", AggFunc("count", Ident("b"))).
+				From("t1", "t2", Join(Alias(pretty.Select().From("t3"), "s"), On(Ident("a").Eq(Ident("c"))))).
+				Where(Ident("u").In(sub)).Group("a").OrderBy("a").Limit(10)
+			sql, err := pretty.SQLString(e)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(`SELECT a, count(b)
+FROM t1, t2
+INNER JOIN (
+  SELECT *
+  FROM t3
+) AS s ON (a = c)
+WHERE u IN (
+  SELECT id
+  FROM u
+  WHERE active = ($1)
+)
+GROUP BY a
+ORDER BY a
+LIMIT 10`))
+		})
+		It("should be off by default", func() {
+			e := q.Select().From("t1", "t2").Where(Ident("a").In(q.Select("id").From("u")))
+			Expect(Q(e)).To(Equal("SELECT * FROM t1 , t2 WHERE a IN (SELECT id FROM u)"))
+		})
+	})
+
+	Describe("Capabilities", func() {
+		It("should render supported features natively", func() {
+			Expect(Q(Ident("a").ILike("x%"))).To(Equal("a ILIKE $1"))
+			Expect(Q(Ident("a").IsDistinctFrom(Ident("b")))).To(Equal("a IS DISTINCT FROM b"))
+			Expect(Q(q.Select(DistinctOn("a"), "a", "b").From("t"))).To(Equal("SELECT DISTINCT ON (a) a, b FROM t"))
+			Expect(Q(q.Select().From("t1", OuterJoin("t2", Using(Ident("c")))))).To(Equal("SELECT * FROM t1 FULL OUTER JOIN t2 USING (c)"))
+		})
+		It("should render window functions", func() {
+			e := Over(Func("row_number"), PartitionBy("dept", Ident("team")), OrderBy(Order("salary", "desc")))
+			Expect(Q(e)).To(Equal("row_number() OVER (PARTITION BY dept, team ORDER BY salary DESC)"))
+			Expect(Q(Over(AggFunc("sum", Ident("x"))))).To(Equal("sum(x) OVER ()"))
+		})
+		It("should emulate ILIKE", func() {
+			my := NewQ(db, MySQLDialect{})
+			sql, v, err := my.SQL(Ident("a").ILike("x%"), Args{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("LOWER(a) LIKE LOWER(?)"))
+			Expect(v).To(Equal([]interface{}{"x%"}))
+		})
+		It("should emulate IS DISTINCT FROM with positional placeholders", func() {
+			my := NewQ(db, MySQLDialect{})
+			sql, v, err := my.SQL(Ident("a").IsNotDistinctFrom(Bind("b")), Args{"b": 1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal("CASE WHEN a = (?) OR (a IS NULL AND (?) IS NULL) THEN 0 ELSE 1 END = 0"))
+			Expect(v).To(Equal([]interface{}{1, 1}))
+		})
+		It("should fail on features that cannot be emulated", func() {
+			my := NewQ(db, MySQLDialect{})
+			var unsupported *UnsupportedFeatureError
+			_, err := my.SQLString(my.Select(DistinctOn("a")).From("t"))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapDistinctOn))
+			_, err = my.SQLString(my.Select().From("t1", OuterJoin("t2", On(Ident("a").Eq(Ident("b"))))))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapFullJoin))
+			custom := NewQ(db, SyntaxDialect{Syntax: DefaultSyntax{}})
+			_, err = custom.SQLString(custom.Select(DistinctOn("a")).From("t"))
+			Expect(err).To(MatchError("DISTINCT ON is not supported by this dialect"))
+		})
+		It("should fail on features in ORDER BY", func() {
+			custom := NewQ(db, SyntaxDialect{Syntax: noWindowSyntax{}})
+			var unsupported *UnsupportedFeatureError
+			_, err := custom.SQLString(custom.Select().From("t").OrderBy(Over(Func("row_number"))))
+			Expect(errors.As(err, &unsupported)).To(BeTrue())
+			Expect(unsupported.Feature).To(Equal(CapWindowFunctions))
+		})
+		It("should be reported by dialects", func() {
+			Expect(PostgresDialect{}.Capabilities().Has(CapILike | CapDistinctOn)).To(BeTrue())
+			Expect(MySQLDialect{}.Capabilities().Has(CapFullJoin)).To(BeFalse())
+			Expect((CapILike | CapFullJoin).String()).To(Equal("FULL JOIN, ILIKE"))
+		})
+	})
+
+	Describe("Interpolate()", func() {
+		It("should write values as escaped literals", func() {
+			e := q.Select().From("t").Where(Ident("a").Eq(Bind("a")).And(Ident("b").Eq("it's")).And(Ident("c").Eq(Bind("c"))))
+			sql, err := q.Interpolate(e, Args{"a": 42, "c": nil})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(InterpolatedComment + "SELECT * FROM t WHERE ((a = (42)) AND (b = 'it''s')) AND (c IS NULL)"))
+		})
+		It("should write bytes, times and arrays for PostgreSQL", func() {
+			at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("", 3600))
+			sql, err := q.Interpolate(Ident("b").Eq(Bind("b")), Args{"b": at})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(InterpolatedComment + "b = ('2024-01-02 03:04:05.6+01:00')"))
+			Expect(PostgresSyntax{}.Literal([]byte{0xde, 0xad})).To(Equal(`'\xdead'::bytea`))
+			Expect(PostgresSyntax{}.Literal([]string{"a", "b'"})).To(Equal("ARRAY['a','b''']"))
+		})
+		It("should use the escaping of the dialect", func() {
+			e := Ident("a").Eq(Bind("a")).And(Ident("b").Eq(Bind("b")))
+			my := NewQ(db, MySQLDialect{})
+			sql, err := my.Interpolate(e, Args{"a": `x\'y`, "b": true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(InterpolatedComment + `(a = ('x\\''y')) AND (b = (TRUE))`))
+			ms := NewQ(db, MSSQLDialect{})
+			sql, err = ms.Interpolate(e, Args{"a": "x", "b": true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(InterpolatedComment + "(a = (N'x')) AND (b = (1))"))
+		})
+		It("should apply converters", func() {
+			q.RegisterConverter(money{}, moneyConverter)
+			sql, err := q.Interpolate(Ident("a").Eq(Bind("a")), Args{"a": money{42}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sql).To(Equal(InterpolatedComment + "a = (42)"))
+		})
+		It("should reject values without a literal form", func() {
+			_, err := q.Interpolate(Ident("a").Eq(Bind("a")), Args{"a": struct{}{}})
+			Expect(err).To(MatchError("cannot write struct {} as an SQL literal"))
+		})
+		It("should report unbound bindings", func() {
+			_, err := q.Interpolate(Ident("a").Eq(Bind("a")), Args{})
+			var bindingErr *BindingError
+			Expect(errors.As(err, &bindingErr)).To(BeTrue())
+		})
+		It("should reject NUL bytes in the SQL", func() {
+			_, err := q.Interpolate(Ident("a\x00").Eq(1), Args{})
+			Expect(err).To(MatchError(ContainSubstring("malformed placeholder marker")))
+		})
+	})
+
+	Describe("SnakeCase()", func() {
+		It("should split words", func() { Expect(SnakeCase("CreatedAt")).To(Equal("created_at")) })
+		It("should keep acronyms together", func() { Expect(SnakeCase("UserID")).To(Equal("user_id")) })
+		It("should split acronyms from words", func() { Expect(SnakeCase("HTTPServer")).To(Equal("http_server")) })
+		It("should lowercase single words", func() { Expect(SnakeCase("ID")).To(Equal("id")) })
 	})
 
 	Describe("Func()", func() {
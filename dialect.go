@@ -1,10 +1,57 @@
 package dbq
 
+import "strings"
+
 type Dialect interface {
 	SQL(e Expression, v Args) (sql string, values []interface{}, err error) // serializes an Expression to string and collects all placeholder bindings, explicit and implicit
 	SQLString(e Expression) (sql string, err error)
 }
 
+// Compiler is implemented by dialects that can serialize an Expression into a reusable Template. The built-in dialects do; *Dbq.Prepare() requires it, and the template cache is bypassed without it.
+type Compiler interface {
+	Compile(e Expression, v Args) (*Template, error) // like SQL(), but keeps track of where the bindings go, so that the result can be reused with other Args of the same shape
+}
+
+// Interpolator is implemented by dialects that can write values inline, which *Dbq.Interpolate() requires. The built-in dialects do.
+type Interpolator interface {
+	// Interpolate serializes an Expression with all values written inline as literals, for debugging. convert, if not nil, is applied to each value first.
+	Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error)
+}
+
+/*
+Template is a serialized query whose bindings can be filled in repeatedly without serializing it again.
+
+The SQL text depends on the Args the query was compiled with: bindings to nil render as NULL, and bindings to slices expand to one placeholder per element.
+A Template can therefore only be reused with Args that have the same keys, the same nil values and the same slice lengths.
+*/
+type Template struct {
+	SQL      string
+	Values   []interface{}    // placeholder values; entries that belong to bindings are filled in by Bind()
+	Bindings map[string][]int // the positions in Values that belong to each binding
+}
+
+// Bind returns the placeholder values for v. A binding that occupies several positions receives the elements of a slice value in order, repeating them if the binding occurs more than once.
+func (t *Template) Bind(v Args) []interface{} {
+	values := make([]interface{}, len(t.Values))
+	copy(values, t.Values)
+	for name, indexes := range t.Bindings {
+		value := v[name]
+		if list, ok := toInterfaceSlice(value); ok {
+			if len(list) == 0 {
+				continue
+			}
+			for i, index := range indexes {
+				values[index] = list[i%len(list)]
+			}
+		} else {
+			for _, index := range indexes {
+				values[index] = value
+			}
+		}
+	}
+	return values
+}
+
 /*
 Ctx is the interface used by Nodes to return (possibly dialect-specific) SQL. It provides a mapping between a dbq type and an SQL subexpression.
 Ctx is used because a query may contain shared state that needs to be accessible by all Nodes (like lists of known placeholders).
@@ -24,4 +71,30 @@ type Ctx interface {
 	Func(*FuncExpr) (string, error)
 	AggFunc(*AggFuncExpr) (string, error)
 	OrderBy(*OrderExpr) (string, error)
+	Window(*WindowExpr) (string, error)
+	Insert(*InsertExpr) (string, error)
+	Update(*UpdateExpr) (string, error)
+	Delete(*DeleteExpr) (string, error)
+	QuotedIdentifier(QuotedIdentifier) (string, error)
+}
+
+/*
+BindingError is returned by Dialect.SQL() when the provided Args do not match the bindings of the query.
+
+A binding whose value is explicitly nil is considered bound; only missing keys are reported.
+*/
+type BindingError struct {
+	Unbound []string // bindings without a value
+	Unused  []string // Args keys that the query does not reference; only reported if the dialect is configured to
+}
+
+func (e *BindingError) Error() string {
+	problems := []string{}
+	if len(e.Unbound) > 0 {
+		problems = append(problems, "unbound: "+strings.Join(e.Unbound, ", "))
+	}
+	if len(e.Unused) > 0 {
+		problems = append(problems, "unused: "+strings.Join(e.Unused, ", "))
+	}
+	return "binding mismatch: " + strings.Join(problems, "; ")
 }
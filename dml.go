@@ -0,0 +1,385 @@
+package dbq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// InsertQuery is a higher-level interface to InsertExpr. Like SelectQuery, it is immutable: every builder method returns a modified copy.
+type InsertQuery struct {
+	Expr
+	q *Dbq
+}
+
+// InsertExpr represents an INSERT statement.
+type InsertExpr struct {
+	table           Node
+	columns         []Expression
+	rows            [][]Expression
+	query           Node // INSERT ... SELECT, instead of rows
+	onConflict      bool
+	conflictTarget  []Expression
+	conflictColumns []Expression // DO UPDATE SET, or DO NOTHING if empty
+	conflictValues  []Expression // the values of conflictColumns, in the same order
+	returning       []Expression
+	Compound
+}
+
+// InsertInto returns a new InsertQuery for the columns of table, which can be a string, an *IdentExpr or an *AliasExpr.
+// The values are added with Values() or Select().
+func (q *Dbq) InsertInto(table interface{}, columns ...string) *InsertQuery {
+	node := &InsertExpr{table: tableSpec(table)}
+	for _, column := range columns {
+		node.columns = append(node.columns, Ident(column))
+	}
+	return &InsertQuery{Expr: Expr{Node: node}, q: q}
+}
+
+func (s *InsertQuery) expr() *InsertExpr {
+	return s.Expr.Node.(*InsertExpr)
+}
+
+func (s *InsertQuery) derive() (*InsertQuery, *InsertExpr) {
+	ex := s.expr().clone()
+	cl := *s
+	cl.Expr = Expr{Node: ex}
+	return &cl, ex
+}
+
+// Values adds a row. Values that are not Expressions are passed in implicit placeholders, as with Literal().
+func (s *InsertQuery) Values(values ...interface{}) *InsertQuery {
+	s, ex := s.derive()
+	row := []Expression{}
+	for _, value := range values {
+		row = append(row, operandToExpression(value))
+	}
+	ex.rows = append(ex.rows, row)
+	return s
+}
+
+// Select makes the statement insert the rows of a query instead of the rows given with Values().
+func (s *InsertQuery) Select(query Expression) *InsertQuery {
+	s, ex := s.derive()
+	ex.query = query
+	return s
+}
+
+/*
+OnConflict adds an ON CONFLICT clause, which skips the rows that would violate a unique constraint on the target columns, or any unique constraint if no target is given.
+Use DoUpdate() to update the existing rows instead:
+
+	q.InsertInto("counters", "name", "n").Values("hits", 1).OnConflict("name").DoUpdate("n", Ident("counters").Col("n").Plus(Excluded("n")))
+
+It requires CapOnConflict.
+*/
+func (s *InsertQuery) OnConflict(target ...interface{}) *InsertQuery {
+	s, ex := s.derive()
+	ex.onConflict = true
+	ex.conflictTarget = toExpressions(target)
+	return s
+}
+
+// DoUpdate adds a column to the DO UPDATE SET clause of ON CONFLICT, like UpdateQuery.Set(). OnConflict() must be called first.
+func (s *InsertQuery) DoUpdate(column string, value interface{}) *InsertQuery {
+	return s.doUpdate(Ident(column), value)
+}
+
+func (s *InsertQuery) doUpdate(column Expression, value interface{}) *InsertQuery {
+	if !s.expr().onConflict {
+		panic(fmt.Errorf("DoUpdate() needs an ON CONFLICT clause"))
+	}
+	s, ex := s.derive()
+	ex.conflictColumns = append(ex.conflictColumns, column)
+	ex.conflictValues = append(ex.conflictValues, operandToExpression(value))
+	return s
+}
+
+// Returning adds a RETURNING clause with the given columns, which can be strings or Expressions. The rows are read with Into().
+// It requires CapReturning.
+func (s *InsertQuery) Returning(columns ...interface{}) *InsertQuery {
+	s, ex := s.derive()
+	ex.returning = append(ex.returning, toExpressions(columns)...)
+	return s
+}
+
+// Into executes a statement with a RETURNING clause and stores the returned rows in target, which is a pointer to a slice, or to a single row as in SelectQuery.Into().
+func (s *InsertQuery) Into(target interface{}, args ...Args) error {
+	return s.q.into(context.Background(), s, target, args)
+}
+
+// Exec executes the statement.
+func (s *InsertQuery) Exec(args ...Args) (sql.Result, error) {
+	return s.q.exec(context.Background(), s, args)
+}
+
+// ExecContext executes the statement.
+func (s *InsertQuery) ExecContext(ctx context.Context, args ...Args) (sql.Result, error) {
+	return s.q.exec(ctx, s, args)
+}
+
+func (s *InsertExpr) String(c Ctx) (string, error) {
+	return c.Insert(s)
+}
+
+func (s *InsertExpr) clone() *InsertExpr {
+	cl := *s
+	cl.columns = append([]Expression(nil), s.columns...)
+	cl.rows = append([][]Expression(nil), s.rows...)
+	cl.conflictTarget = append([]Expression(nil), s.conflictTarget...)
+	cl.conflictColumns = append([]Expression(nil), s.conflictColumns...)
+	cl.conflictValues = append([]Expression(nil), s.conflictValues...)
+	cl.returning = append([]Expression(nil), s.returning...)
+	return &cl
+}
+
+func (s *InsertExpr) Table() Node             { return s.table }
+func (s *InsertExpr) Columns() []Expression   { return append([]Expression(nil), s.columns...) }
+func (s *InsertExpr) Query() Node             { return s.query } // the query of INSERT ... SELECT, or nil
+func (s *InsertExpr) Returning() []Expression { return append([]Expression(nil), s.returning...) }
+
+// OnConflict returns the target of the ON CONFLICT clause, and whether there is one.
+func (s *InsertExpr) OnConflict() (target []Expression, ok bool) {
+	return append([]Expression(nil), s.conflictTarget...), s.onConflict
+}
+
+// ConflictUpdate returns the DO UPDATE SET clause of ON CONFLICT, which is empty for DO NOTHING.
+func (s *InsertExpr) ConflictUpdate() (columns, values []Expression) {
+	return append([]Expression(nil), s.conflictColumns...), append([]Expression(nil), s.conflictValues...)
+}
+
+// Rows returns the rows given with InsertQuery.Values().
+func (s *InsertExpr) Rows() [][]Expression {
+	rows := [][]Expression{}
+	for _, row := range s.rows {
+		rows = append(rows, append([]Expression(nil), row...))
+	}
+	return rows
+}
+
+// UpdateQuery is a higher-level interface to UpdateExpr. Like SelectQuery, it is immutable: every builder method returns a modified copy.
+type UpdateQuery struct {
+	Expr
+	q *Dbq
+}
+
+// UpdateExpr represents an UPDATE statement.
+type UpdateExpr struct {
+	table      Node
+	columns    []Expression
+	values     []Expression // the values of columns, in the same order
+	conditions []Expression
+	returning  []Expression
+	Compound
+}
+
+// Update returns a new UpdateQuery for table, which can be a string, an *IdentExpr or an *AliasExpr.
+func (q *Dbq) Update(table interface{}) *UpdateQuery {
+	node := &UpdateExpr{table: tableSpec(table)}
+	return &UpdateQuery{Expr: Expr{Node: node}, q: q}
+}
+
+func (s *UpdateQuery) expr() *UpdateExpr {
+	return s.Expr.Node.(*UpdateExpr)
+}
+
+func (s *UpdateQuery) derive() (*UpdateQuery, *UpdateExpr) {
+	ex := s.expr().clone()
+	cl := *s
+	cl.Expr = Expr{Node: ex}
+	return &cl, ex
+}
+
+// Set adds a column to the SET clause. A value that is not an Expression is passed in an implicit placeholder, as with Literal().
+func (s *UpdateQuery) Set(column string, value interface{}) *UpdateQuery {
+	return s.set(Ident(column), value)
+}
+
+func (s *UpdateQuery) set(column Expression, value interface{}) *UpdateQuery {
+	s, ex := s.derive()
+	ex.columns = append(ex.columns, column)
+	ex.values = append(ex.values, operandToExpression(value))
+	return s
+}
+
+// Where adds conditions, like SelectQuery.Where().
+func (s *UpdateQuery) Where(specs ...interface{}) *UpdateQuery {
+	s, ex := s.derive()
+	ex.conditions = append(ex.conditions, conditionSpecs(specs)...)
+	return s
+}
+
+// Returning adds a RETURNING clause, like InsertQuery.Returning().
+func (s *UpdateQuery) Returning(columns ...interface{}) *UpdateQuery {
+	s, ex := s.derive()
+	ex.returning = append(ex.returning, toExpressions(columns)...)
+	return s
+}
+
+// Into executes a statement with a RETURNING clause, like InsertQuery.Into().
+func (s *UpdateQuery) Into(target interface{}, args ...Args) error {
+	return s.q.into(context.Background(), s, target, args)
+}
+
+// Exec executes the statement.
+func (s *UpdateQuery) Exec(args ...Args) (sql.Result, error) {
+	return s.q.exec(context.Background(), s, args)
+}
+
+// ExecContext executes the statement.
+func (s *UpdateQuery) ExecContext(ctx context.Context, args ...Args) (sql.Result, error) {
+	return s.q.exec(ctx, s, args)
+}
+
+func (s *UpdateExpr) String(c Ctx) (string, error) {
+	return c.Update(s)
+}
+
+func (s *UpdateExpr) clone() *UpdateExpr {
+	cl := *s
+	cl.columns = append([]Expression(nil), s.columns...)
+	cl.values = append([]Expression(nil), s.values...)
+	cl.conditions = append([]Expression(nil), s.conditions...)
+	cl.returning = append([]Expression(nil), s.returning...)
+	return &cl
+}
+
+func (s *UpdateExpr) Table() Node              { return s.table }
+func (s *UpdateExpr) Columns() []Expression    { return append([]Expression(nil), s.columns...) }
+func (s *UpdateExpr) Values() []Expression     { return append([]Expression(nil), s.values...) } // in the order of Columns()
+func (s *UpdateExpr) Conditions() []Expression { return append([]Expression(nil), s.conditions...) }
+func (s *UpdateExpr) Returning() []Expression  { return append([]Expression(nil), s.returning...) }
+
+// Where returns a copy of the expression with additional conditions, like SelectExpr.Where().
+func (s *UpdateExpr) Where(conditions ...Expression) *UpdateExpr {
+	cl := s.clone()
+	cl.conditions = append(cl.conditions, conditions...)
+	return cl
+}
+
+// DeleteQuery is a higher-level interface to DeleteExpr. Like SelectQuery, it is immutable: every builder method returns a modified copy.
+type DeleteQuery struct {
+	Expr
+	q *Dbq
+}
+
+// DeleteExpr represents a DELETE statement.
+type DeleteExpr struct {
+	table      Node
+	conditions []Expression
+	returning  []Expression
+	Compound
+}
+
+// DeleteFrom returns a new DeleteQuery for table, which can be a string, an *IdentExpr or an *AliasExpr.
+// Without conditions, the statement deletes every row.
+func (q *Dbq) DeleteFrom(table interface{}) *DeleteQuery {
+	node := &DeleteExpr{table: tableSpec(table)}
+	return &DeleteQuery{Expr: Expr{Node: node}, q: q}
+}
+
+func (s *DeleteQuery) expr() *DeleteExpr {
+	return s.Expr.Node.(*DeleteExpr)
+}
+
+// Where adds conditions, like SelectQuery.Where().
+func (s *DeleteQuery) Where(specs ...interface{}) *DeleteQuery {
+	ex := s.expr().Where(conditionSpecs(specs)...)
+	cl := *s
+	cl.Expr = Expr{Node: ex}
+	return &cl
+}
+
+// Returning adds a RETURNING clause, like InsertQuery.Returning().
+func (s *DeleteQuery) Returning(columns ...interface{}) *DeleteQuery {
+	ex := *s.expr()
+	ex.returning = append(append([]Expression(nil), ex.returning...), toExpressions(columns)...)
+	cl := *s
+	cl.Expr = Expr{Node: &ex}
+	return &cl
+}
+
+// Into executes a statement with a RETURNING clause, like InsertQuery.Into().
+func (s *DeleteQuery) Into(target interface{}, args ...Args) error {
+	return s.q.into(context.Background(), s, target, args)
+}
+
+// Exec executes the statement.
+func (s *DeleteQuery) Exec(args ...Args) (sql.Result, error) {
+	return s.q.exec(context.Background(), s, args)
+}
+
+// ExecContext executes the statement.
+func (s *DeleteQuery) ExecContext(ctx context.Context, args ...Args) (sql.Result, error) {
+	return s.q.exec(ctx, s, args)
+}
+
+func (s *DeleteExpr) String(c Ctx) (string, error) {
+	return c.Delete(s)
+}
+
+func (s *DeleteExpr) Table() Node              { return s.table }
+func (s *DeleteExpr) Conditions() []Expression { return append([]Expression(nil), s.conditions...) }
+func (s *DeleteExpr) Returning() []Expression  { return append([]Expression(nil), s.returning...) }
+
+// Where returns a copy of the expression with additional conditions, like SelectExpr.Where().
+func (s *DeleteExpr) Where(conditions ...Expression) *DeleteExpr {
+	cl := *s
+	cl.conditions = append(append([]Expression(nil), s.conditions...), conditions...)
+	return &cl
+}
+
+// Excluded returns a column of the row that was proposed for insertion, for use in InsertQuery.DoUpdate().
+func Excluded(column string) Expression {
+	return Ident("excluded").Col(column)
+}
+
+// tableSpec converts the table argument of the statement constructors.
+func tableSpec(spec interface{}) Node {
+	switch spec := spec.(type) {
+	case string:
+		return Ident(spec)
+	case *IdentExpr:
+		return spec
+	case *AliasExpr:
+		return spec
+	default:
+		panic(fmt.Errorf("Cannot use %v [%v] as a table spec", spec, reflect.TypeOf(spec)))
+	}
+}
+
+// exec executes a statement that does not return rows.
+func (q *Dbq) exec(ctx context.Context, e Expression, args []Args) (sql.Result, error) {
+	query, values, err := q.SQL(e, mergeArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return q.ExecContext(ctx, query, values...)
+}
+
+// into executes a statement that returns rows and scans them into target.
+func (q *Dbq) into(ctx context.Context, e Expression, target interface{}, args []Args) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Into() expects a pointer")
+	}
+	query, values, err := q.SQL(e, mergeArgs(args))
+	if err != nil {
+		return err
+	}
+	rows, err := q.QueryContext(ctx, query, values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if v.Elem().Kind() == reflect.Slice {
+		return q.scanRows(v, rows, cols, q.scanMode)
+	}
+	_, err = q.scanSingleRow(v, rows, cols, q.scanMode, false)
+	return err
+}
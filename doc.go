@@ -5,14 +5,17 @@ dbq works by dynamically constructing SQL syntax trees and generating queries fr
 
 Examples in this document assume the package is dot-imported for brevity.
 
-Getting started
+# Getting started
 
 A *Dbq value is needed to generate queries. Obtain it like this:
+
 	q := NewQ(dbconn, PostgresDialect{})
 
-dbconn doesn't need to be a valid connection unless you want to use dbq for loading data (which is only partially implemented at the moment). PostgresDialect is currently the only available dialect.
+dbconn doesn't need to be a valid connection unless you want to use dbq for loading data (which is only partially implemented at the moment). The available dialects are PostgresDialect, MySQLDialect, SQLiteDialect and MSSQLDialect; others can be assembled from a Syntax with SyntaxDialect.
+
+Each dialect writes a query on a single line by default. Set Pretty, as in PostgresDialect{DialectOptions{Pretty: true}}, to put every clause on its own line and indent subqueries, which is easier to read in logs and golden files.
 
-Expressions and composition
+# Expressions and composition
 
 Two basic types in dbq are Node and Expression. Everything is a Node; most things are also Expressions. An Expression can be combined with other Expressions to form more complex ones.
 
@@ -20,28 +23,43 @@ The basic expressions are literals, created with Literal(), and identifiers, cre
 
 Keep in mind that dbq is generally very liberal in what types of arguments it accepts, and not all combinations result in valid SQL. Aliases are one such example: there is no structural difference between a table alias and a column/expression alias, but the database engine will complain if you mix them up.
 
-SELECT
+# SELECT
 
 A SELECT expression has the following basic structure:
+
 	q.Select(columns...).From(tables...).Where(conditions...).Limit(n).Offset(n)
 
-Each of the methods returns the same *SelectQuery value, so you can chain them as you like. Multiple calls to the same method will accumulate arguments.
+Each of the methods returns a new *SelectQuery value and leaves the receiver unchanged, so you can chain them as you like, and derive multiple queries from a common base. Multiple calls to the same method will accumulate arguments.
 
-Column list
+# Column list
 
 Any Expression can be used as a column. You can wrap them with Alias() to give them a name. A bare string is also accepted here, and is identical to using an identifier.
 
-Table list
+# Table list
 
 ...
 
-Condition list
+# Condition list
 
 ...
 
-Limit and Offset
+# Limit and Offset
 
 ...
 
+# Inspecting and rewriting queries
+
+Walk() visits the nodes of a query, and Rewrite() derives a modified copy of it, e.g. to add a condition to every SELECT or to rename tables. Nodes expose their parts through accessors such as BinaryOp.Left() and SelectExpr.Tables().
+
+Existing SQL can be brought into dbq with Parse(), which turns a PostgreSQL SELECT statement into a *SelectQuery, ParseStatement(), which also accepts INSERT, UPDATE and DELETE, and ParseExpr(), which does the same for a single expression.
+
+# Modifying data
+
+InsertInto(), Update() and DeleteFrom() build the other statements, which are executed with Exec():
+
+	_, err := q.Update("users").Set("active", false).Where(Ident("last_login").Less(Bind("cutoff"))).Exec(Args{"cutoff": cutoff})
+
+Returning() adds a RETURNING clause, whose rows are read with Into() instead of Exec(), and InsertQuery.OnConflict() turns the statement into an upsert.
+Dialects that lack CapReturning or CapOnConflict fail with an *UnsupportedFeatureError.
 */
 package dbq
@@ -38,6 +38,12 @@ type Expression interface {
 	GreaterEq(other interface{}) Expression
 
 	In(other interface{}) Expression
+	NotIn(other interface{}) Expression
+
+	Like(other interface{}) Expression
+	ILike(other interface{}) Expression
+	IsDistinctFrom(other interface{}) Expression
+	IsNotDistinctFrom(other interface{}) Expression
 
 	And(other interface{}) Expression
 	Or(other interface{}) Expression
@@ -92,6 +98,28 @@ func (e *Expr) Or(other interface{}) Expression {
 func (e *Expr) In(other interface{}) Expression {
 	return In(e, other)
 }
+func (e *Expr) NotIn(other interface{}) Expression {
+	return NotIn(e, other)
+}
+func (e *Expr) Like(other interface{}) Expression {
+	return Binary(e, "LIKE", other)
+}
+
+// ILike is a case-insensitive LIKE. It is emulated with LOWER() in dialects without CapILike.
+func (e *Expr) ILike(other interface{}) Expression {
+	return Binary(e, "ILIKE", other)
+}
+
+// IsDistinctFrom is a comparison that treats NULLs as equal to each other and different from all other values.
+// It is emulated with CASE in dialects without CapDistinctFrom.
+func (e *Expr) IsDistinctFrom(other interface{}) Expression {
+	return Binary(e, "IS DISTINCT FROM", other)
+}
+
+// IsNotDistinctFrom is the negation of IsDistinctFrom().
+func (e *Expr) IsNotDistinctFrom(other interface{}) Expression {
+	return Binary(e, "IS NOT DISTINCT FROM", other)
+}
 func (e *Expr) Cast(typ string) Expression {
 	return Cast(e, typ)
 }
@@ -0,0 +1,164 @@
+package dbq
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InterpolatedComment starts the output of Interpolate(), to make it obvious in logs that the SQL is not what was sent to the database.
+const InterpolatedComment = "/* dbq: values inlined for debugging, not for execution */ "
+
+// Interpolate serializes e with the values of v and the implicit placeholders written inline, as literals of the dialect:
+//
+//	/* dbq: values inlined for debugging, not for execution */ SELECT * FROM t WHERE (a = 'x') AND (b = 42)
+//
+// The values are converted with the registered converters first, and escaped using the rules of the dialect, so the output can be pasted into a database console, e.g. for EXPLAIN.
+// It is still meant for logging and debugging only: the escaping depends on server settings that dbq cannot see, and queries should be executed with placeholders.
+func (q *Dbq) Interpolate(e Expression, v Args) (string, error) {
+	d, ok := q.Dialect.(Interpolator)
+	if !ok {
+		return "", fmt.Errorf("dbq: %T cannot interpolate values", q.Dialect)
+	}
+	converters := q.converters.snapshot()
+	return d.Interpolate(e, v, func(value interface{}) (interface{}, error) {
+		return convertValue(converters, value)
+	})
+}
+
+// inlineMarker stands in for the nth placeholder while interpolating. It cannot occur in the SQL otherwise.
+func inlineMarker(n int) string {
+	return "\x00" + strconv.Itoa(n) + "\x00"
+}
+
+// Interpolate serializes e with all values inline, like Interpolator.Interpolate(). convert, if not nil, is applied to each value before it is written.
+// A BaseCtx is meant to serialize a single query, so Interpolate must only be called once.
+func (c *BaseCtx) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	c.inline = true
+	t, err := c.Compile(e, v, false)
+	if err != nil {
+		return "", err
+	}
+	values := t.Bind(v)
+
+	var sql strings.Builder
+	sql.WriteString(InterpolatedComment)
+	rest := t.SQL
+	for {
+		start := strings.IndexByte(rest, 0)
+		if start < 0 {
+			sql.WriteString(rest)
+			break
+		}
+		length := strings.IndexByte(rest[start+1:], 0)
+		if length < 0 {
+			// a NUL byte that did not come from inlineMarker()
+			return "", fmt.Errorf("dbq: malformed placeholder marker in %q", t.SQL)
+		}
+		end := start + 1 + length
+		n, err := strconv.Atoi(rest[start+1 : end])
+		if err != nil || n < 1 || n > len(values) {
+			return "", fmt.Errorf("dbq: malformed placeholder marker in %q", t.SQL)
+		}
+		value := values[n-1]
+		if convert != nil {
+			if value, err = convert(value); err != nil {
+				return "", err
+			}
+		}
+		literal, err := c.Syntax.Literal(value)
+		if err != nil {
+			return "", err
+		}
+		sql.WriteString(rest[:start])
+		sql.WriteString(literal)
+		rest = rest[end+1:]
+	}
+	return sql.String(), nil
+}
+
+// literalValue reduces value to one of the types that Syntax.Literal() implementations handle: nil, bool, int64, uint64, float64, string, []byte, time.Time, or a slice of other values.
+// driver.Valuers are asked for their value, pointers are dereferenced, and named types are converted to their underlying type.
+func literalValue(value interface{}) (interface{}, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		var err error
+		if value, err = valuer.Value(); err != nil {
+			return nil, err
+		}
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if _, ok := value.(time.Time); ok {
+		return value, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return literalValue(v.Elem().Interface())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+	}
+	return value, nil
+}
+
+// quoteString writes s as a standard SQL string literal, in which only the quote needs escaping.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Literal writes value as an SQL literal, for Interpolate().
+func (DefaultSyntax) Literal(value interface{}) (string, error) {
+	value, err := literalValue(value)
+	if err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if value {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "", fmt.Errorf("cannot write %v as an SQL literal", value)
+		}
+		return strconv.FormatFloat(value, 'g', -1, 64), nil
+	case string:
+		return quoteString(value), nil
+	case []byte:
+		return "X'" + hex.EncodeToString(value) + "'", nil
+	case time.Time:
+		return "'" + value.Format("2006-01-02 15:04:05.999999") + "'", nil
+	}
+	return "", fmt.Errorf("cannot write %T as an SQL literal", value)
+}
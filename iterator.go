@@ -0,0 +1,115 @@
+package dbq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Iterator steps through the rows of a query result one at a time, without loading the whole result into memory.
+//
+// It follows the conventions of *sql.Rows:
+//
+//	it, err := q.Select().From("t").Iterate(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		var row T
+//		if err := it.Scan(&row); err != nil {
+//			return err
+//		}
+//	}
+//	return it.Err()
+type Iterator struct {
+	rows     *sql.Rows
+	cols     []string
+	q        *Dbq
+	mode     ScanMode
+	scanType reflect.Type
+	scanner  *rowScanner
+}
+
+// Iterate executes the query and returns an Iterator over its results.
+// The Iterator must be closed when it's no longer needed.
+func (s *SelectQuery) Iterate(ctx context.Context, args ...Args) (*Iterator, error) {
+	rows, cols, err := s.execute(ctx, mergeArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return &Iterator{rows: rows, cols: cols, q: s.q, mode: s.scanMode()}, nil
+}
+
+// Next prepares the next row for scanning. It returns false when there are no more rows or an error has occurred.
+func (it *Iterator) Next() bool {
+	return it.rows.Next()
+}
+
+// Scan stores the current row in target, which must be a pointer to a single-row target accepted by Into().
+func (it *Iterator) Scan(target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Scan() expects a pointer")
+	}
+	if it.scanner == nil || it.scanType != v.Type().Elem() {
+		sc, err := it.q.rowScanner(v.Type().Elem(), it.cols, it.mode)
+		if err != nil {
+			return err
+		}
+		it.scanner, it.scanType = sc, v.Type().Elem()
+	}
+	return it.scanner.scan(it.rows, v)
+}
+
+// Columns returns the column names of the result.
+func (it *Iterator) Columns() []string {
+	return it.cols
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (it *Iterator) Err() error {
+	return it.rows.Err()
+}
+
+// Close releases the underlying result set. It is safe to call it multiple times.
+func (it *Iterator) Close() error {
+	return it.rows.Close()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+/*
+Each executes the query and calls fn for every row of the result, stopping at the first error.
+
+fn must be a function of the form
+
+	func(*T) error
+
+where T is a type accepted by Iterator.Scan(). Each row is scanned into a newly allocated T.
+*/
+func (s *SelectQuery) Each(ctx context.Context, fn interface{}, args ...Args) error {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0).Kind() != reflect.Ptr || t.NumOut() != 1 || t.Out(0) != errorType {
+		return fmt.Errorf("Each() expects a func(*T) error, got %v", t)
+	}
+	targetType := t.In(0).Elem()
+
+	it, err := s.Iterate(ctx, args...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		target := reflect.New(targetType)
+		if err = it.Scan(target.Interface()); err != nil {
+			return err
+		}
+		if result := reflect.ValueOf(fn).Call([]reflect.Value{target})[0]; !result.IsNil() {
+			return result.Interface().(error)
+		}
+	}
+	return it.Err()
+}
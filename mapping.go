@@ -0,0 +1,255 @@
+package dbq
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NameMapper translates a struct field name into the column name it is matched against when scanning.
+// It is only consulted for fields that do not specify a column name in a `db` tag.
+type NameMapper func(field string) string
+
+// DefaultMapper matches columns against lowercased field names. It is used unless another mapper is set with SetMapper().
+var DefaultMapper NameMapper = strings.ToLower
+
+// SnakeCase maps CamelCase field names to snake_case columns, e.g. CreatedAt to created_at and UserID to user_id.
+func SnakeCase(field string) string {
+	runes := []rune(field)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+					out = append(out, '_')
+				}
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// SetMapper changes the NameMapper used to match columns to struct fields.
+func (q *Dbq) SetMapper(m NameMapper) *Dbq {
+	q.fields.Lock()
+	defer q.fields.Unlock()
+	q.mapper = m
+	q.fields.types = nil
+	return q
+}
+
+// structMap describes how column names map onto the fields of a struct type.
+type structMap struct {
+	columns map[string]*fieldMap
+	pk      string  // the column of the field marked with the pk tag option, if any
+	ptrs    [][]int // the indexes of pointer-to-struct fields, each before the ones nested in it
+
+	converters map[reflect.Type]Converter // types with converters are mapped as single columns
+	inside     map[reflect.Type]bool      // the pointed-to types being mapped, to stop at recursive types
+}
+
+// fieldMap describes a single mapped field.
+type fieldMap struct {
+	index    []int  // as accepted by reflect.Value.FieldByIndex
+	name     string // Go selector relative to the mapped struct, e.g. Author.Name
+	optional bool   // set with the optional tag option; such fields are not reported by ScanStrictFields
+}
+
+// fieldCache holds the structMaps computed for a *Dbq, so that struct types are only inspected once.
+type fieldCache struct {
+	sync.RWMutex
+	types map[reflect.Type]*structMap
+}
+
+// structMap returns the (cached) column mapping for the struct type t.
+func (q *Dbq) structMap(t reflect.Type) *structMap {
+	q.fields.RLock()
+	m, ok := q.fields.types[t]
+	q.fields.RUnlock()
+	if ok {
+		return m
+	}
+
+	q.fields.Lock()
+	defer q.fields.Unlock()
+	if m, ok := q.fields.types[t]; ok {
+		return m
+	}
+	mapper := q.mapper
+	if mapper == nil {
+		mapper = DefaultMapper
+	}
+	m = newStructMap(t, mapper, q.converters.snapshot())
+	if q.fields.types == nil {
+		q.fields.types = make(map[reflect.Type]*structMap)
+	}
+	q.fields.types[t] = m
+	return m
+}
+
+func newStructMap(t reflect.Type, mapper NameMapper, converters map[reflect.Type]Converter) *structMap {
+	m := &structMap{columns: make(map[string]*fieldMap), converters: converters, inside: make(map[reflect.Type]bool)}
+	m.addFields(t, nil, "", "", mapper)
+	m.inside = nil
+	return m
+}
+
+// addFields maps the fields of t, reached via the index path parent and the selector parentName, to columns starting with prefix.
+//
+// Anonymous struct fields are flattened into their parent, as in Go. Named struct fields are mapped to prefixed columns:
+// by default, the prefix is the field's column name followed by a dot (author.name), but it can be set explicitly with the prefix tag option:
+//
+//	Author User `db:",prefix=author_"` // author_name
+//
+// Pointers to structs are mapped the same way, and are left nil if all their columns are NULL, as in a LEFT JOIN without a match.
+// A struct type that is already being mapped further up is skipped, so that recursive types do not map forever.
+//
+// On conflicts, the shallowest field wins, and among fields at the same depth, the first one does.
+func (m *structMap) addFields(t reflect.Type, parent []int, parentName, prefix string, mapper NameMapper) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous { // unexported
+			continue
+		}
+		name, opts := parseTag(f.Tag.Get("db"))
+		if name == "-" {
+			continue
+		}
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+		goName := f.Name
+		if parentName != "" {
+			goName = parentName + "." + f.Name
+		}
+
+		ft := f.Type
+		ptr := ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && !hasConverter(m.converters, ft)
+		if ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && !isScannable(ft) && !hasConverter(m.converters, ft) {
+			if ptr && (f.PkgPath != "" || m.inside[ft]) { // cannot be allocated, or recursive
+				continue
+			}
+			nested, explicit := tagOpt(opts, "prefix")
+			if f.Anonymous && name == "" && !explicit { // flattened into the parent
+				goName = parentName
+			} else if !explicit {
+				if name == "" {
+					name = mapper(f.Name)
+				}
+				nested = name + "."
+			}
+			if ptr {
+				m.ptrs = append(m.ptrs, index)
+				m.inside[ft] = true
+			}
+			m.addFields(ft, index, goName, prefix+nested, mapper)
+			if ptr {
+				delete(m.inside, ft)
+			}
+			continue
+		}
+		if f.PkgPath != "" { // embedded non-struct of an unexported type
+			continue
+		}
+
+		if name == "" {
+			name = mapper(f.Name)
+		}
+		col := prefix + name
+		if existing, exists := m.columns[col]; !exists || len(index) < len(existing.index) {
+			m.columns[col] = &fieldMap{index: index, name: goName, optional: hasOpt(opts, "optional")}
+		}
+		if m.pk == "" && hasOpt(opts, "pk") {
+			m.pk = col
+		}
+	}
+}
+
+// parseTag splits a `db` tag into the column name and its comma-separated options.
+func parseTag(tag string) (name string, opts []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+// tagOpt looks up a key=value option in a parsed tag.
+func tagOpt(opts []string, key string) (value string, ok bool) {
+	for _, opt := range opts {
+		if strings.HasPrefix(opt, key+"=") {
+			return opt[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// hasOpt reports whether a parsed tag has the flag option key.
+func hasOpt(opts []string, key string) bool {
+	for _, opt := range opts {
+		if opt == key {
+			return true
+		}
+	}
+	return false
+}
+
+// paths resolves a list of result columns to field indexes. Columns that do not match any field get a nil entry.
+func (m *structMap) paths(cols []string) [][]int {
+	paths := make([][]int, len(cols))
+	for i, col := range cols {
+		if f, ok := m.columns[col]; ok {
+			paths[i] = f.index
+		}
+	}
+	return paths
+}
+
+// check verifies that cols match the fields of t according to the strictness flags in mode.
+func (m *structMap) check(t reflect.Type, cols []string, mode ScanMode) error {
+	err := &MappingError{Type: t}
+	present := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		present[col] = true
+		if _, ok := m.columns[col]; !ok && mode&ScanStrictColumns != 0 {
+			err.UnmappedColumns = append(err.UnmappedColumns, col)
+		}
+	}
+	if mode&ScanStrictFields != 0 {
+		for col, f := range m.columns {
+			if !present[col] && !f.optional {
+				err.UnfilledFields = append(err.UnfilledFields, f.name)
+			}
+		}
+		sort.Strings(err.UnfilledFields)
+	}
+	if len(err.UnmappedColumns) > 0 || len(err.UnfilledFields) > 0 {
+		return err
+	}
+	return nil
+}
+
+// MappingError is returned by Into() in strict scan modes when the result columns and the target fields do not match up.
+type MappingError struct {
+	Type            reflect.Type
+	UnmappedColumns []string // result columns that do not correspond to any field
+	UnfilledFields  []string // fields that no result column maps to
+}
+
+func (e *MappingError) Error() string {
+	problems := []string{}
+	if len(e.UnmappedColumns) > 0 {
+		problems = append(problems, "unmapped columns: "+strings.Join(e.UnmappedColumns, ", "))
+	}
+	if len(e.UnfilledFields) > 0 {
+		problems = append(problems, "unfilled fields: "+strings.Join(e.UnfilledFields, ", "))
+	}
+	return fmt.Sprintf("cannot scan into %v: %s", e.Type, strings.Join(problems, "; "))
+}
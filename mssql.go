@@ -0,0 +1,227 @@
+package dbq
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+/*
+MSSQLDialect generates T-SQL for Microsoft SQL Server 2012 and later.
+
+Placeholders are numbered (@p1, @p2, ...), the convention of the common Go drivers, so a binding that occurs several times in a query is passed only once.
+Row limits use TOP when there is no offset, and OFFSET ... FETCH NEXT otherwise. Since OFFSET requires an ORDER BY, a query without one is ordered by (SELECT NULL), which leaves the order unspecified as it would be anyway.
+Conversely, T-SQL rejects ORDER BY in a subquery without a row limit, where it has no effect, so it is left out there.
+RETURNING is written as an OUTPUT clause, with unqualified column names taken from the INSERTED or DELETED rows.
+T-SQL has no boolean literals, so constant conditions are rendered as comparisons.
+*/
+type MSSQLDialect struct {
+	DialectOptions
+}
+
+func (d MSSQLDialect) SQL(e Expression, v Args) (string, []interface{}, error) {
+	return d.dialect().SQL(e, v)
+}
+
+func (d MSSQLDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.dialect().Compile(e, v)
+}
+
+func (d MSSQLDialect) SQLString(e Expression) (string, error) {
+	return d.dialect().SQLString(e)
+}
+
+func (d MSSQLDialect) Capabilities() Capability {
+	return MSSQLSyntax{}.Capabilities()
+}
+
+func (d MSSQLDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.dialect().Interpolate(e, v, convert)
+}
+
+func (d MSSQLDialect) Ctx() *MSSQLCtx {
+	c := &MSSQLCtx{BaseCtx: BaseCtx{Syntax: MSSQLSyntax{}, Pretty: d.Pretty}}
+	c.Self = c
+	return c
+}
+
+// dialect returns the ctxDialect that does the work of d.
+func (d MSSQLDialect) dialect() ctxDialect {
+	return ctxDialect{ctx: func() *BaseCtx { return &d.Ctx().BaseCtx }, DialectOptions: d.DialectOptions}
+}
+
+type MSSQLCtx struct {
+	BaseCtx
+	depth int // the number of statements being serialized, counting subqueries
+}
+
+// Select leaves out the ORDER BY clause of a subquery without a row limit.
+func (c *MSSQLCtx) Select(s *SelectExpr) (string, error) {
+	c.depth++
+	defer func() { c.depth-- }()
+	if c.depth > 1 && s.order != nil && s.limit == 0 && s.offset == 0 {
+		unordered := *s
+		unordered.order = nil
+		return c.BaseCtx.Select(&unordered)
+	}
+	return c.BaseCtx.Select(s)
+}
+
+// Insert writes RETURNING as OUTPUT INSERTED..., between the column list and the values.
+func (c *MSSQLCtx) Insert(s *InsertExpr) (string, error) {
+	c.depth++
+	defer func() { c.depth-- }()
+	without := *s
+	without.returning = nil
+	sql, err := c.insertClauses(&without)
+	if err != nil {
+		return "", err
+	}
+	return c.output(sql, 1, "INSERTED", s.returning)
+}
+
+// Update writes RETURNING as OUTPUT INSERTED..., between SET and WHERE.
+func (c *MSSQLCtx) Update(s *UpdateExpr) (string, error) {
+	c.depth++
+	defer func() { c.depth-- }()
+	without := *s
+	without.returning = nil
+	sql, err := c.updateClauses(&without)
+	if err != nil {
+		return "", err
+	}
+	return c.output(sql, 2, "INSERTED", s.returning)
+}
+
+// Delete writes RETURNING as OUTPUT DELETED..., before WHERE.
+func (c *MSSQLCtx) Delete(s *DeleteExpr) (string, error) {
+	c.depth++
+	defer func() { c.depth-- }()
+	without := *s
+	without.returning = nil
+	sql, err := c.deleteClauses(&without)
+	if err != nil {
+		return "", err
+	}
+	return c.output(sql, 1, "DELETED", s.returning)
+}
+
+// output inserts an OUTPUT clause for columns at position i of the clauses of a statement, and joins them.
+// Unqualified column names refer to the rows in the pseudo table rows.
+func (c *MSSQLCtx) output(sql []string, i int, rows string, columns []Expression) (string, error) {
+	if len(columns) == 0 {
+		return c.clauses(sql), nil
+	}
+	if err := c.require(CapReturning); err != nil {
+		return "", err
+	}
+	qualified := []Expression{}
+	for _, column := range columns {
+		qualified = append(qualified, Rewrite(column, func(n Node) Node {
+			switch id := n.(type) {
+			case Identifier:
+				if !strings.Contains(string(id), ".") {
+					return Identifier(rows + "." + c.Syntax.Quote(string(id)))
+				}
+			case QuotedIdentifier:
+				return Identifier(rows + "." + c.Syntax.Quote(string(id)))
+			}
+			return n
+		}).(Expression))
+	}
+	list, err := c.list(qualified)
+	if err != nil {
+		return "", err
+	}
+	sql = append(sql[:i], append([]string{"OUTPUT " + list}, sql[i:]...)...)
+	return c.clauses(sql), nil
+}
+
+// JoinCondition rejects USING, which T-SQL does not have.
+func (c *MSSQLCtx) JoinCondition(jc *JoinCondition) (sql string, err error) {
+	if jc.kind == JoinUsing {
+		return "", fmt.Errorf("SQL Server does not support JOIN ... USING")
+	}
+	return c.BaseCtx.JoinCondition(jc)
+}
+
+// AggFunc moves the ordering of an aggregate into a WITHIN GROUP clause, as used by STRING_AGG().
+func (c *MSSQLCtx) AggFunc(f *AggFuncExpr) (sql string, err error) {
+	if f.order == nil {
+		return c.BaseCtx.AggFunc(f)
+	}
+	unordered := *f
+	unordered.order = nil
+	sql, err = c.BaseCtx.AggFunc(&unordered)
+	if err != nil {
+		return
+	}
+	order, err := f.order.String(c.outer())
+	if err != nil {
+		return
+	}
+	return sql + " WITHIN GROUP (" + order + ")", nil
+}
+
+// MSSQLSyntax is the Syntax of MSSQLDialect: numbered @pN placeholders, bracket quoting, TOP and OFFSET ... FETCH.
+type MSSQLSyntax struct {
+	DefaultSyntax
+}
+
+func (MSSQLSyntax) Placeholder(n int) string { return fmt.Sprintf("@p%d", n) }
+func (MSSQLSyntax) Positional() bool         { return false }
+
+func (MSSQLSyntax) Quote(ident string) string {
+	return "[" + strings.Replace(ident, "]", "]]", -1) + "]"
+}
+
+func (MSSQLSyntax) Boolean(b bool) string {
+	if b {
+		return "(1 = 1)"
+	}
+	return "(1 = 0)"
+}
+
+func (MSSQLSyntax) Capabilities() Capability { return CapReturning | CapFullJoin | CapWindowFunctions }
+
+func (MSSQLSyntax) Top(limit, offset uint) string {
+	if limit > 0 && offset == 0 {
+		return fmt.Sprintf("TOP %d", limit)
+	}
+	return ""
+}
+
+func (MSSQLSyntax) Limit(limit, offset uint, ordered bool) string {
+	if offset == 0 {
+		return ""
+	}
+	clauses := []string{}
+	if !ordered {
+		clauses = append(clauses, "ORDER BY (SELECT NULL)")
+	}
+	clauses = append(clauses, fmt.Sprintf("OFFSET %d ROWS", offset))
+	if limit > 0 {
+		clauses = append(clauses, fmt.Sprintf("FETCH NEXT %d ROWS ONLY", limit))
+	}
+	return strings.Join(clauses, " ")
+}
+
+// Literal writes strings as N'...', bytes as 0x..., and booleans as 1 and 0.
+func (s MSSQLSyntax) Literal(value interface{}) (string, error) {
+	value, err := literalValue(value)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return "N" + quoteString(v), nil
+	case []byte:
+		return "0x" + hex.EncodeToString(v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	}
+	return s.DefaultSyntax.Literal(value)
+}
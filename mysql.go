@@ -0,0 +1,97 @@
+package dbq
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+MySQLDialect generates SQL for MySQL 8.
+
+Placeholders are positional, so a binding that occurs several times in a query takes up a placeholder, and a value, for every occurrence.
+Constructs that MySQL does not have, like FULL OUTER JOIN, RETURNING and ON CONFLICT, fail to serialize instead of producing SQL that the server rejects.
+*/
+type MySQLDialect struct {
+	DialectOptions
+}
+
+func (d MySQLDialect) SQL(e Expression, v Args) (string, []interface{}, error) {
+	return d.dialect().SQL(e, v)
+}
+
+func (d MySQLDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.dialect().Compile(e, v)
+}
+
+func (d MySQLDialect) SQLString(e Expression) (string, error) {
+	return d.dialect().SQLString(e)
+}
+
+func (d MySQLDialect) Capabilities() Capability {
+	return MySQLSyntax{}.Capabilities()
+}
+
+func (d MySQLDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.dialect().Interpolate(e, v, convert)
+}
+
+func (d MySQLDialect) Ctx() *MySQLCtx {
+	c := &MySQLCtx{BaseCtx{Syntax: MySQLSyntax{}, Pretty: d.Pretty}}
+	c.Self = c
+	return c
+}
+
+// dialect returns the ctxDialect that does the work of d.
+func (d MySQLDialect) dialect() ctxDialect {
+	return ctxDialect{ctx: func() *BaseCtx { return &d.Ctx().BaseCtx }, DialectOptions: d.DialectOptions}
+}
+
+type MySQLCtx struct {
+	BaseCtx
+}
+
+// AggFunc rejects ORDER BY in aggregates other than GROUP_CONCAT, the only one that supports it in MySQL.
+func (c *MySQLCtx) AggFunc(f *AggFuncExpr) (sql string, err error) {
+	if f.order != nil && !strings.EqualFold(f.name, "group_concat") {
+		return "", fmt.Errorf("MySQL does not support ORDER BY in %s()", f.name)
+	}
+	return c.BaseCtx.AggFunc(f)
+}
+
+// MySQLSyntax is the Syntax of MySQLDialect: positional ? placeholders, backtick quoting and MySQL's LIMIT offset, count.
+type MySQLSyntax struct {
+	DefaultSyntax
+}
+
+// mysqlMaxLimit is the documented way to express an OFFSET without a LIMIT.
+const mysqlMaxLimit = "18446744073709551615"
+
+func (MySQLSyntax) Quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func (MySQLSyntax) Limit(limit, offset uint, ordered bool) string {
+	switch {
+	case offset > 0 && limit > 0:
+		return fmt.Sprintf("LIMIT %d, %d", offset, limit)
+	case offset > 0:
+		return fmt.Sprintf("LIMIT %d, %s", offset, mysqlMaxLimit)
+	case limit > 0:
+		return fmt.Sprintf("LIMIT %d", limit)
+	}
+	return ""
+}
+
+func (MySQLSyntax) Capabilities() Capability { return CapWindowFunctions }
+
+// Literal escapes backslashes in strings as well, as MySQL does unless NO_BACKSLASH_ESCAPES is set.
+func (s MySQLSyntax) Literal(value interface{}) (string, error) {
+	value, err := literalValue(value)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := value.(string); ok {
+		return quoteString(strings.Replace(v, `\`, `\\`, -1)), nil
+	}
+	return s.DefaultSyntax.Literal(value)
+}
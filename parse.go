@@ -0,0 +1,1085 @@
+package dbq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError is returned by Parse() and ParseExpr() for SQL that is malformed, or that uses a construct dbq cannot represent.
+type ParseError struct {
+	Line, Column int // the position of the offending token, counting from 1
+	Message      string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("syntax error at line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+/*
+Parse turns a SELECT statement written in PostgreSQL syntax into a query, which can be extended with the builder methods and serialized with any dialect:
+
+	legacy, err := q.Parse(`SELECT id, name FROM users u JOIN teams t ON t.id = u.team_id WHERE t.active`)
+	...
+	err = legacy.Where(Ident("u.role").Eq(Bind("role"))).Into(&users, Args{"role": "admin"})
+
+The supported subset is what dbq can represent:
+
+	SELECT [DISTINCT | DISTINCT ON (...)] columns [FROM tables and joins] [WHERE ...] [GROUP BY ...] [ORDER BY ...] [LIMIT n] [OFFSET n]
+
+with expressions made of identifiers, literals, parameters, operators, IN, BETWEEN, IS [NOT] NULL, casts, function calls, window functions and subqueries.
+Unquoted identifiers are kept as written. Quoted ones lose their quotes, and are quoted again by the dialect that serializes the query, so "user id" becomes `user id` for MySQL. Numbered parameters such as $1 become bindings with the same name, as do named ones such as :name, without the colon.
+String and other non-integer literals become implicit placeholders, as with Literal().
+
+dbq has no nodes for HAVING, CASE, set operations and a few other constructs, so they are rejected with a *ParseError. INSERT, UPDATE and DELETE statements are parsed by ParseStatement().
+*/
+func (q *Dbq) Parse(sql string) (s *SelectQuery, err error) {
+	p, err := newParser(q, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+	if p.isKeyword("insert", "update", "delete") {
+		p.fail("expected SELECT, found %s; use ParseStatement() for other statements", p.peek())
+	}
+	s = p.parseStatement().(*SelectQuery)
+	p.expectEnd()
+	return
+}
+
+/*
+ParseStatement turns a SELECT, INSERT, UPDATE or DELETE statement written in PostgreSQL syntax into a *SelectQuery, *InsertQuery, *UpdateQuery or *DeleteQuery respectively:
+
+	stmt, err := q.ParseStatement(`UPDATE users SET active = false WHERE last_login < $1`)
+	...
+	_, err = stmt.(*UpdateQuery).Where(Ident("role").NotEq("admin")).Exec(Args{"$1": cutoff})
+
+Besides SELECT as described for Parse(), the supported subset is:
+
+	INSERT INTO table [(columns)] {VALUES (...) [, ...] | SELECT ...}
+		[ON CONFLICT [(columns)] {DO NOTHING | DO UPDATE SET column = value [, ...]}] [RETURNING ...]
+	UPDATE table [[AS] alias] SET column = value [, ...] [WHERE ...] [RETURNING ...]
+	DELETE FROM table [[AS] alias] [WHERE ...] [RETURNING ...]
+
+RETURNING takes a list of columns like SELECT, except for *. ON CONSTRAINT, DO UPDATE ... WHERE, UPDATE ... FROM and DELETE ... USING are rejected with a *ParseError.
+Whether RETURNING and ON CONFLICT can be serialized depends on the capabilities of the dialect.
+*/
+func (q *Dbq) ParseStatement(sql string) (e Expression, err error) {
+	p, err := newParser(q, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+	e = p.parseStatement()
+	p.expectEnd()
+	return
+}
+
+// ParseExpr turns a PostgreSQL expression, such as a condition from a legacy query, into an Expression. It accepts the same expressions as Parse().
+func (q *Dbq) ParseExpr(sql string) (e Expression, err error) {
+	p, err := newParser(q, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer p.recover(&err)
+	e = p.parseExpr()
+	p.expectEnd()
+	return
+}
+
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // an unquoted identifier or a keyword
+	tokenQuoted           // a "quoted identifier", without the quotes
+	tokenNumber
+	tokenString // a 'string literal', unescaped
+	tokenParam  // $1 or :name
+	tokenOp     // an operator or punctuation
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset in the SQL
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return quoteString(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators are the operator tokens, longest first.
+var operators = []string{"::", "<=", ">=", "<>", "!=", "||", "(", ")", ",", ".", ";", "*", "+", "-", "/", "%", "=", "<", ">", "[", "]"}
+
+func isWordStart(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+func isWordPart(b byte) bool {
+	return isWordStart(b) || isDigit(b) || b == '$'
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// lex splits sql into tokens, skipping whitespace and comments.
+func lex(sql string) (tokens []token, err error) {
+	i := 0
+	for {
+		for i < len(sql) && strings.IndexByte(" \t\r\n\f", sql[i]) >= 0 {
+			i++
+		}
+		if strings.HasPrefix(sql[i:], "--") {
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+			continue
+		}
+		if strings.HasPrefix(sql[i:], "/*") {
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, newParseError(sql, i, "unterminated comment")
+			}
+			i += end + 4
+			continue
+		}
+		if i == len(sql) {
+			return append(tokens, token{kind: tokenEOF, pos: i}), nil
+		}
+		start := i
+		switch b := sql[i]; {
+		case isWordStart(b):
+			for i < len(sql) && isWordPart(sql[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, sql[start:i], start})
+		case isDigit(b) || b == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+				i++
+				if i < len(sql) && (sql[i] == '+' || sql[i] == '-') {
+					i++
+				}
+				for i < len(sql) && isDigit(sql[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokenNumber, sql[start:i], start})
+		case b == '"' || b == '\'':
+			// the quote character is escaped by doubling it
+			var text strings.Builder
+			for i++; ; i++ {
+				if i == len(sql) {
+					return nil, newParseError(sql, start, "unterminated quote")
+				}
+				if sql[i] == b {
+					if i+1 < len(sql) && sql[i+1] == b {
+						i++
+					} else {
+						break
+					}
+				}
+				text.WriteByte(sql[i])
+			}
+			i++
+			if b == '"' {
+				tokens = append(tokens, token{tokenQuoted, text.String(), start})
+			} else {
+				tokens = append(tokens, token{tokenString, text.String(), start})
+			}
+		case b == '$' && i+1 < len(sql) && isDigit(sql[i+1]),
+			b == ':' && i+1 < len(sql) && isWordStart(sql[i+1]):
+			for i++; i < len(sql) && isWordPart(sql[i]) && sql[i] != '$'; i++ {
+			}
+			tokens = append(tokens, token{tokenParam, sql[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(sql[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, newParseError(sql, i, fmt.Sprintf("unexpected character %q", sql[i]))
+			}
+			i += len(op)
+			tokens = append(tokens, token{tokenOp, op, start})
+		}
+	}
+}
+
+func newParseError(sql string, pos int, message string) *ParseError {
+	before := sql[:pos]
+	line := strings.Count(before, "\n") + 1
+	column := pos - strings.LastIndexByte(before, '\n')
+	return &ParseError{Line: line, Column: column, Message: message}
+}
+
+// reserved are the keywords that cannot be used as identifiers or implicit aliases.
+var reserved = map[string]bool{
+	"all": true, "and": true, "as": true, "asc": true, "between": true, "by": true, "case": true, "cast": true, "cross": true,
+	"delete": true, "desc": true, "distinct": true, "else": true, "end": true, "except": true, "exists": true, "false": true,
+	"fetch": true, "for": true, "from": true, "full": true, "group": true, "having": true, "ilike": true, "in": true,
+	"inner": true, "insert": true, "intersect": true, "into": true, "is": true, "join": true, "lateral": true, "left": true,
+	"like": true, "limit": true, "natural": true, "not": true, "null": true, "nulls": true, "offset": true, "on": true,
+	"or": true, "order": true, "outer": true, "over": true, "partition": true, "returning": true, "right": true,
+	"select": true, "set": true, "then": true, "true": true, "union": true, "update": true, "using": true, "values": true,
+	"when": true, "where": true, "window": true, "with": true,
+}
+
+// parser is a recursive descent parser. Errors are raised by panicking with a *ParseError, which Parse() and ParseExpr() recover from.
+type parser struct {
+	q      *Dbq
+	sql    string
+	tokens []token
+	i      int
+}
+
+func newParser(q *Dbq, sql string) (*parser, error) {
+	tokens, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{q: q, sql: sql, tokens: tokens}, nil
+}
+
+func (p *parser) recover(err *error) {
+	if r := recover(); r != nil {
+		parseErr, ok := r.(*ParseError)
+		if !ok {
+			panic(r)
+		}
+		*err = parseErr
+	}
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(newParseError(p.sql, p.peek().pos, fmt.Sprintf(format, args...)))
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// isKeyword reports whether the next token is one of the keywords, which are given in lower case.
+func (p *parser) isKeyword(keywords ...string) bool {
+	t := p.peek()
+	if t.kind != tokenWord {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) {
+	if !p.acceptKeyword(keyword) {
+		p.fail("expected %s, found %s", strings.ToUpper(keyword), p.peek())
+	}
+}
+
+func (p *parser) isOp(op string) bool {
+	t := p.peek()
+	return t.kind == tokenOp && t.text == op
+}
+
+func (p *parser) acceptOp(op string) bool {
+	if p.isOp(op) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) {
+	if !p.acceptOp(op) {
+		p.fail("expected %q, found %s", op, p.peek())
+	}
+}
+
+func (p *parser) expectEnd() {
+	if p.peek().kind != tokenEOF {
+		p.fail("unexpected %s", p.peek())
+	}
+}
+
+// unsupported rejects the constructs that dbq has no nodes for, if one comes next.
+func (p *parser) unsupported(keywords ...string) {
+	if p.isKeyword(keywords...) {
+		p.fail("%s is not supported", strings.ToUpper(p.peek().text))
+	}
+}
+
+// isSubquery reports whether a parenthesized SELECT comes next.
+func (p *parser) isSubquery() bool {
+	next := p.tokens[p.i+1:]
+	return p.isOp("(") && next[0].kind == tokenWord && strings.EqualFold(next[0].text, "select")
+}
+
+// isName reports whether the next token can be an identifier.
+func (p *parser) isName() bool {
+	t := p.peek()
+	return t.kind == tokenQuoted || t.kind == tokenWord && !reserved[strings.ToLower(t.text)]
+}
+
+// parseName parses an identifier: an Identifier as written, or a QuotedIdentifier without the quotes, which the dialect quotes again.
+func (p *parser) parseName() Node {
+	if !p.isName() {
+		p.fail("expected an identifier, found %s", p.peek())
+	}
+	t := p.next()
+	if t.kind == tokenQuoted {
+		return QuotedIdentifier(t.text)
+	}
+	return Identifier(t.text)
+}
+
+// parseQualifiedName parses a possibly qualified name such as schema.table into a QualifiedName, or a single part.
+func (p *parser) parseQualifiedName() Node {
+	name := QualifiedName{p.parseName()}
+	for p.acceptOp(".") {
+		name = append(name, p.parseName())
+	}
+	return nameNode(name)
+}
+
+// nameNode returns name, or its only part.
+func nameNode(name QualifiedName) Node {
+	if len(name) == 1 {
+		return name[0]
+	}
+	return name
+}
+
+// parseAlias parses an optional alias, with or without AS.
+func (p *parser) parseAlias() (name Node, ok bool) {
+	if p.acceptKeyword("as") {
+		return p.parseName(), true
+	}
+	if p.isName() {
+		return p.parseName(), true
+	}
+	return nil, false
+}
+
+// alias is Alias() for a parsed name.
+func alias(source Node, name Node) *AliasExpr {
+	return &AliasExpr{Expression: ident(name), Source: source}
+}
+
+// parseStatement parses a complete statement, with an optional semicolon.
+func (p *parser) parseStatement() (e Expression) {
+	switch {
+	case p.isKeyword("with"):
+		p.fail("WITH is not supported")
+	case p.isKeyword("select"):
+		e = p.parseSelect()
+	case p.isKeyword("insert"):
+		e = p.parseInsert()
+	case p.isKeyword("update"):
+		e = p.parseUpdate()
+	case p.isKeyword("delete"):
+		e = p.parseDelete()
+	default:
+		p.fail("expected SELECT, INSERT, UPDATE or DELETE, found %s", p.peek())
+	}
+	p.acceptOp(";")
+	return
+}
+
+func (p *parser) parseInsert() *InsertQuery {
+	p.expectKeyword("insert")
+	p.expectKeyword("into")
+	var table Node = ident(p.parseQualifiedName())
+	if p.acceptKeyword("as") {
+		table = alias(table, p.parseName())
+	}
+	s, ex := p.q.InsertInto(table).derive()
+	if !p.isSubquery() && p.acceptOp("(") {
+		for {
+			ex.columns = append(ex.columns, ident(p.parseName()))
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		p.expectOp(")")
+	}
+	switch {
+	case p.acceptKeyword("values"):
+		for {
+			p.expectOp("(")
+			s = s.Values(p.parseExprList()...)
+			p.expectOp(")")
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	case p.isKeyword("select"):
+		s = s.Select(p.parseSelect())
+	case p.isSubquery():
+		p.next()
+		s = s.Select(p.parseSelect())
+		p.expectOp(")")
+	default:
+		p.unsupported("default")
+		p.fail("expected VALUES or SELECT, found %s", p.peek())
+	}
+	if p.acceptKeyword("on") {
+		p.expectKeyword("conflict")
+		p.unsupported("on")
+		target := []interface{}{}
+		if p.acceptOp("(") {
+			target = p.parseExprList()
+			p.expectOp(")")
+		}
+		s = s.OnConflict(target...)
+		p.expectKeyword("do")
+		if !p.acceptKeyword("nothing") {
+			p.expectKeyword("update")
+			p.expectKeyword("set")
+			for {
+				column := ident(p.parseName())
+				p.expectOp("=")
+				s = s.doUpdate(column, p.parseExpr())
+				if !p.acceptOp(",") {
+					break
+				}
+			}
+			p.unsupported("where")
+		}
+	}
+	if columns := p.parseReturning(); columns != nil {
+		s = s.Returning(columns...)
+	}
+	return s
+}
+
+// parseReturning parses an optional RETURNING clause, and returns nil if there is none.
+func (p *parser) parseReturning() (columns []interface{}) {
+	if !p.acceptKeyword("returning") {
+		return nil
+	}
+	if p.isOp("*") {
+		p.fail("RETURNING * is not supported")
+	}
+	for {
+		columns = append(columns, p.parseColumn())
+		if !p.acceptOp(",") {
+			return
+		}
+	}
+}
+
+func (p *parser) parseUpdate() *UpdateQuery {
+	p.expectKeyword("update")
+	p.unsupported("only")
+	var table Node = ident(p.parseQualifiedName())
+	if name, ok := p.parseAlias(); ok {
+		table = alias(table, name)
+	}
+	s := p.q.Update(table)
+	p.expectKeyword("set")
+	for {
+		if p.isOp("(") {
+			p.fail("assigning several columns at once is not supported")
+		}
+		column := ident(p.parseName())
+		p.expectOp("=")
+		s = s.set(column, p.parseExpr())
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	p.unsupported("from")
+	if p.acceptKeyword("where") {
+		s = s.Where(p.parseExpr())
+	}
+	if columns := p.parseReturning(); columns != nil {
+		s = s.Returning(columns...)
+	}
+	return s
+}
+
+func (p *parser) parseDelete() *DeleteQuery {
+	p.expectKeyword("delete")
+	p.expectKeyword("from")
+	p.unsupported("only")
+	var table Node = ident(p.parseQualifiedName())
+	if name, ok := p.parseAlias(); ok {
+		table = alias(table, name)
+	}
+	s := p.q.DeleteFrom(table)
+	p.unsupported("using")
+	if p.acceptKeyword("where") {
+		s = s.Where(p.parseExpr())
+	}
+	if columns := p.parseReturning(); columns != nil {
+		s = s.Returning(columns...)
+	}
+	return s
+}
+
+func (p *parser) parseSelect() *SelectQuery {
+	p.expectKeyword("select")
+	spec := []interface{}{}
+	if p.acceptKeyword("distinct") {
+		if p.acceptKeyword("on") {
+			p.expectOp("(")
+			spec = append(spec, DistinctOn(p.parseExprList()...))
+			p.expectOp(")")
+		} else {
+			spec = append(spec, Distinct{})
+		}
+	} else {
+		p.acceptKeyword("all")
+	}
+	if !p.acceptOp("*") {
+		for {
+			spec = append(spec, p.parseColumn())
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	s := p.q.Select(spec...)
+
+	if p.acceptKeyword("from") {
+		s = s.From(p.parseTables()...)
+	}
+	if p.acceptKeyword("where") {
+		s = s.Where(p.parseExpr())
+	}
+	if p.acceptKeyword("group") {
+		p.expectKeyword("by")
+		s = s.Group(p.parseExprList()...)
+	}
+	p.unsupported("having", "window")
+	if p.acceptKeyword("order") {
+		p.expectKeyword("by")
+		s = s.OrderBy(p.parseOrderClauses()...)
+	}
+	for {
+		if p.acceptKeyword("limit") {
+			if !p.acceptKeyword("all") {
+				s = s.Limit(p.parseCount())
+			}
+		} else if p.acceptKeyword("offset") {
+			s = s.Offset(p.parseCount())
+			if !p.acceptKeyword("rows") {
+				p.acceptKeyword("row")
+			}
+		} else {
+			break
+		}
+	}
+	p.unsupported("union", "intersect", "except", "fetch", "for")
+	return s
+}
+
+func (p *parser) parseColumn() interface{} {
+	e := p.parseExpr()
+	if name, ok := p.parseAlias(); ok {
+		return alias(e, name)
+	}
+	return e
+}
+
+func (p *parser) parseCount() uint {
+	t := p.peek()
+	n, err := strconv.ParseUint(t.text, 10, 0)
+	if t.kind != tokenNumber || err != nil {
+		p.fail("expected a row count, found %s", t)
+	}
+	p.next()
+	return uint(n)
+}
+
+// parseTables parses the FROM clause into specs for SelectQuery.From().
+func (p *parser) parseTables() (specs []interface{}) {
+	specs = append(specs, p.parseTable())
+	for {
+		p.unsupported("natural")
+		switch {
+		case p.acceptOp(","):
+			specs = append(specs, p.parseTable())
+		case p.acceptKeyword("cross"):
+			p.expectKeyword("join")
+			specs = append(specs, CrossJoin(p.parseTable()))
+		case p.isKeyword("join", "inner"):
+			if p.acceptKeyword("inner") {
+				p.expectKeyword("join")
+			} else {
+				p.next()
+			}
+			table := p.parseTable()
+			specs = append(specs, Join(table, p.parseJoinCondition()))
+		case p.isKeyword("left", "right", "full"):
+			kind := strings.ToLower(p.next().text)
+			p.acceptKeyword("outer")
+			p.expectKeyword("join")
+			table := p.parseTable()
+			condition := p.parseJoinCondition()
+			switch kind {
+			case "left":
+				specs = append(specs, LeftJoin(table, condition))
+			case "right":
+				specs = append(specs, RightJoin(table, condition))
+			default:
+				specs = append(specs, OuterJoin(table, condition))
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseTable parses a table name or a subquery, with an optional alias.
+func (p *parser) parseTable() interface{} {
+	p.unsupported("lateral")
+	if p.acceptOp("(") {
+		sub := p.parseSelect()
+		p.expectOp(")")
+		name, ok := p.parseAlias()
+		if !ok {
+			p.fail("a subquery in FROM must have an alias")
+		}
+		return alias(sub, name)
+	}
+	table := ident(p.parseQualifiedName())
+	if name, ok := p.parseAlias(); ok {
+		return alias(table, name)
+	}
+	return table
+}
+
+func (p *parser) parseJoinCondition() *JoinCondition {
+	if p.acceptKeyword("on") {
+		return On(p.parseExpr())
+	}
+	p.expectKeyword("using")
+	p.expectOp("(")
+	columns := exprList{}
+	for {
+		columns = append(columns, ident(p.parseName()))
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	p.expectOp(")")
+	if len(columns) == 1 {
+		return Using(columns[0])
+	}
+	return Using(columns)
+}
+
+func (p *parser) parseOrderClauses() (clauses []interface{}) {
+	for {
+		e := p.parseExpr()
+		order := OrderDefault
+		if p.acceptKeyword("asc") {
+			order = OrderAsc
+		} else if p.acceptKeyword("desc") {
+			order = OrderDesc
+		}
+		p.unsupported("nulls")
+		clauses = append(clauses, Order(e, order))
+		if !p.acceptOp(",") {
+			return
+		}
+	}
+}
+
+func (p *parser) parseExprList() (exprs []interface{}) {
+	for {
+		exprs = append(exprs, p.parseExpr())
+		if !p.acceptOp(",") {
+			return
+		}
+	}
+}
+
+// exprList is a parenthesized list of expressions, as in IN (a, b + 1) or USING (a, b). Unlike a LiteralList, its elements are serialized as they are.
+type exprList []Expression
+
+func (exprList) IsCompound() bool { return true }
+
+func (l exprList) String(c Ctx) (string, error) {
+	strs := []string{}
+	for _, e := range l {
+		sql, err := e.String(c)
+		if err != nil {
+			return "", err
+		}
+		strs = append(strs, sql)
+	}
+	return strings.Join(strs, ","), nil
+}
+
+// The expression grammar follows the operator precedence of PostgreSQL, from the loosest binding to the tightest.
+
+func (p *parser) parseExpr() Expression {
+	e := p.parseAnd()
+	for p.acceptKeyword("or") {
+		e = e.Or(p.parseAnd())
+	}
+	return e
+}
+
+func (p *parser) parseAnd() Expression {
+	e := p.parseNot()
+	for p.acceptKeyword("and") {
+		e = e.And(p.parseNot())
+	}
+	return e
+}
+
+func (p *parser) parseNot() Expression {
+	if p.acceptKeyword("not") {
+		// there is no unary operator node, but NOT can be written like a function call
+		return Func("NOT", p.parseNot())
+	}
+	return p.parseIs()
+}
+
+func (p *parser) parseIs() Expression {
+	e := p.parseComparison()
+	for p.acceptKeyword("is") {
+		not := p.acceptKeyword("not")
+		switch {
+		case p.acceptKeyword("null"):
+			if not {
+				e = Binary(e, "IS NOT", nil)
+			} else {
+				e = Binary(e, "IS", nil)
+			}
+		case p.acceptKeyword("distinct"):
+			p.expectKeyword("from")
+			if not {
+				e = e.IsNotDistinctFrom(p.parseComparison())
+			} else {
+				e = e.IsDistinctFrom(p.parseComparison())
+			}
+		default:
+			p.fail("expected NULL or DISTINCT FROM, found %s", p.peek())
+		}
+	}
+	return e
+}
+
+var comparisonOps = map[string]bool{"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) parseComparison() Expression {
+	e := p.parsePredicate()
+	for t := p.peek(); t.kind == tokenOp && comparisonOps[t.text]; t = p.peek() {
+		p.next()
+		e = Binary(e, t.text, p.parsePredicate())
+	}
+	return e
+}
+
+// parsePredicate parses [NOT] LIKE, ILIKE, IN and BETWEEN.
+func (p *parser) parsePredicate() Expression {
+	e := p.parseConcat()
+	for {
+		start := p.i
+		not := p.acceptKeyword("not")
+		switch {
+		case p.isKeyword("like", "ilike"):
+			var match Expression
+			if strings.EqualFold(p.next().text, "like") {
+				match = e.Like(p.parseConcat())
+			} else {
+				match = e.ILike(p.parseConcat())
+			}
+			if not {
+				// as with NOT alone, so that dialects can still emulate ILIKE
+				match = Func("NOT", match)
+			}
+			e = match
+		case p.acceptKeyword("in"):
+			list := p.parseInList()
+			if not {
+				e = NotIn(e, list)
+			} else {
+				e = In(e, list)
+			}
+		case p.acceptKeyword("between"):
+			// written out as comparisons, which dbq can represent
+			low := p.parseConcat()
+			p.expectKeyword("and")
+			high := p.parseConcat()
+			if not {
+				e = e.Less(low).Or(e.Greater(high))
+			} else {
+				e = e.GreaterEq(low).And(e.LessEq(high))
+			}
+		default:
+			p.i = start
+			return e
+		}
+	}
+}
+
+func (p *parser) parseInList() (list interface{}) {
+	p.expectOp("(")
+	if p.isKeyword("select") {
+		list = p.parseSelect()
+	} else {
+		list = &Expr{exprList(toExpressions(p.parseExprList()))}
+	}
+	p.expectOp(")")
+	return
+}
+
+func (p *parser) parseConcat() Expression {
+	e := p.parseAdditive()
+	for p.acceptOp("||") {
+		e = Binary(e, "||", p.parseAdditive())
+	}
+	return e
+}
+
+func (p *parser) parseAdditive() Expression {
+	e := p.parseMultiplicative()
+	for p.isOp("+") || p.isOp("-") {
+		e = Binary(e, p.next().text, p.parseMultiplicative())
+	}
+	return e
+}
+
+func (p *parser) parseMultiplicative() Expression {
+	e := p.parseUnary()
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		e = Binary(e, p.next().text, p.parseUnary())
+	}
+	return e
+}
+
+func (p *parser) parseUnary() Expression {
+	if p.acceptOp("+") {
+		return p.parseUnary()
+	}
+	if p.acceptOp("-") {
+		if t := p.peek(); t.kind == tokenNumber {
+			p.next()
+			return p.parseCasts(p.number("-" + t.text))
+		}
+		return Func("-", p.parseUnary())
+	}
+	return p.parseCasts(p.parsePrimary())
+}
+
+func (p *parser) parseCasts(e Expression) Expression {
+	for p.acceptOp("::") {
+		e = e.Cast(p.parseType())
+	}
+	return e
+}
+
+// typeWords are the words that continue a type name, as in double precision or timestamp with time zone.
+var typeWords = map[string]bool{"precision": true, "varying": true, "with": true, "without": true, "time": true, "zone": true}
+
+// parseType parses a type name, which is kept as written, including quotes.
+func (p *parser) parseType() string {
+	name := ""
+	for {
+		if !p.isName() {
+			p.fail("expected a type, found %s", p.peek())
+		}
+		t := p.next()
+		if t.kind == tokenQuoted {
+			name += `"` + strings.Replace(t.text, `"`, `""`, -1) + `"`
+		} else {
+			name += t.text
+		}
+		if !p.acceptOp(".") {
+			break
+		}
+		name += "."
+	}
+	words := []string{name}
+	for p.peek().kind == tokenWord && typeWords[strings.ToLower(p.peek().text)] {
+		words = append(words, p.next().text)
+	}
+	typ := strings.Join(words, " ")
+	if p.acceptOp("(") {
+		modifiers := []string{}
+		for {
+			if p.peek().kind != tokenNumber {
+				p.fail("expected a type modifier, found %s", p.peek())
+			}
+			modifiers = append(modifiers, p.next().text)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		p.expectOp(")")
+		typ += "(" + strings.Join(modifiers, ",") + ")"
+	}
+	for p.acceptOp("[") {
+		p.expectOp("]")
+		typ += "[]"
+	}
+	return typ
+}
+
+func (p *parser) number(text string) Expression {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return Literal(n)
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.fail("invalid number %s", text)
+	}
+	return Literal(f)
+}
+
+func (p *parser) parsePrimary() Expression {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		return p.number(t.text)
+	case tokenString:
+		p.next()
+		return Literal(t.text)
+	case tokenParam:
+		p.next()
+		return Bind(strings.TrimPrefix(t.text, ":"))
+	case tokenOp:
+		if p.acceptOp("(") {
+			var e Expression
+			if p.isKeyword("select") {
+				e = p.parseSelect()
+			} else {
+				e = p.parseExpr()
+			}
+			p.expectOp(")")
+			return e
+		}
+	case tokenWord:
+		switch strings.ToLower(t.text) {
+		case "null":
+			p.next()
+			return Literal(nil)
+		case "true", "false":
+			p.next()
+			return Literal(strings.EqualFold(t.text, "true"))
+		case "exists":
+			p.next()
+			p.expectOp("(")
+			sub := p.parseSelect()
+			p.expectOp(")")
+			return Func("EXISTS", sub)
+		case "cast":
+			p.next()
+			p.expectOp("(")
+			e := p.parseExpr()
+			p.expectKeyword("as")
+			typ := p.parseType()
+			p.expectOp(")")
+			return e.Cast(typ)
+		}
+	}
+	p.unsupported("case", "array", "interval")
+	if p.isKeyword("left", "right") && p.tokens[p.i+1].kind == tokenOp && p.tokens[p.i+1].text == "(" {
+		// reserved for joins, but also the names of string functions
+		p.next()
+		p.next()
+		return p.parseCall(t.text)
+	}
+	if !p.isName() {
+		p.fail("unexpected %s", t)
+	}
+	if t.kind == tokenWord && p.tokens[p.i+1].kind == tokenOp && p.tokens[p.i+1].text == "(" {
+		p.next()
+		p.next()
+		return p.parseCall(t.text)
+	}
+	name := QualifiedName{p.parseName()}
+	for p.acceptOp(".") {
+		if p.acceptOp("*") {
+			return ident(append(name, Identifier("*")))
+		}
+		name = append(name, p.parseName())
+	}
+	if p.isOp("(") {
+		p.fail("quoted and qualified function names are not supported")
+	}
+	return ident(nameNode(name))
+}
+
+// parseCall parses the arguments of a function call, after the opening parenthesis, and an optional window.
+func (p *parser) parseCall(name string) Expression {
+	var call Expression
+	if p.acceptOp("*") {
+		call = Func(name, Ident("*"))
+	} else {
+		args := []interface{}{}
+		plain := true
+		if p.acceptKeyword("distinct") {
+			args = append(args, Distinct{})
+			plain = false
+		} else if p.acceptKeyword("all") {
+			args = append(args, All{})
+			plain = false
+		}
+		if !p.isOp(")") {
+			args = append(args, p.parseExprList()...)
+		}
+		if p.acceptKeyword("order") {
+			p.expectKeyword("by")
+			args = append(args, OrderBy(p.parseOrderClauses()...))
+			plain = false
+		}
+		if plain {
+			call = Func(name, toExpressions(args)...)
+		} else {
+			call = AggFunc(name, args...)
+		}
+	}
+	p.expectOp(")")
+	if !p.acceptKeyword("over") {
+		return call
+	}
+	p.expectOp("(")
+	spec := []interface{}{}
+	if p.acceptKeyword("partition") {
+		p.expectKeyword("by")
+		spec = append(spec, PartitionBy(p.parseExprList()...))
+	}
+	if p.acceptKeyword("order") {
+		p.expectKeyword("by")
+		spec = append(spec, OrderBy(p.parseOrderClauses()...))
+	}
+	p.expectOp(")")
+	return Over(call, spec...)
+}
@@ -1,351 +1,91 @@
 package dbq
 
 import (
+	"encoding/hex"
+	"fmt"
 	"reflect"
 	"strings"
-
-	"fmt"
+	"time"
 )
 
-type PostgresDialect struct{}
-
-func (d PostgresDialect) SQL(e Expression, v Args) (sql string, values []interface{}, err error) {
-	c := d.Ctx()
-	c.dynamicValues = v
-	sql, err = e.String(c)
-	for _, v := range c.placeholderValues {
-		values = append(values, v)
-	}
-	for k, v := range v {
-		if v == nil {
-			continue
-		}
-		indexes, ok := c.placeholderNameToIndexes[k]
-		if ok {
-			if genericList, ok := toInterfaceSlice(v); ok {
-				for i, index := range indexes {
-					values[index-1] = genericList[i]
-				}
-			} else {
-				values[indexes[0]-1] = v
-			}
-		}
-	}
-	return
-}
-func (d PostgresDialect) SQLString(e Expression) (sql string, err error) {
-	c := d.Ctx()
-	sql, err = e.String(c)
-	return
+type PostgresDialect struct {
+	DialectOptions
 }
 
-func (PostgresDialect) Ctx() *PostgresCtx {
-	return &PostgresCtx{placeholderNameToIndexes: make(map[string][]int)}
+func (d PostgresDialect) SQL(e Expression, v Args) (string, []interface{}, error) {
+	return d.dialect().SQL(e, v)
 }
 
-type PostgresCtx struct {
-	placeholderValues        []interface{}
-	placeholderNameToIndexes map[string][]int
-	dynamicValues            Args
+func (d PostgresDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.dialect().Compile(e, v)
 }
 
-func (c *PostgresCtx) BindValue(b *Binding) (value interface{}, ok bool) {
-	value, ok = c.dynamicValues[b.name]
-	return
+func (d PostgresDialect) SQLString(e Expression) (string, error) {
+	return d.dialect().SQLString(e)
 }
 
-func (c *PostgresCtx) BinaryOp(e *BinaryOp) (sql string, err error) {
-	a, err := e.a.String(c)
-	if err != nil {
-		return
-	}
-	b, err := e.b.String(c)
-	if err != nil {
-		return
-	}
-	if e.a.IsCompound() {
-		a = "(" + a + ")"
-	}
-	if e.b.IsCompound() {
-		b = "(" + b + ")"
-	}
-	nullable, ok := e.b.(Nullable)
-	if ok && nullable.IsNull(c) && (e.op == "=" || e.op == "!=") {
-		if e.op == "=" {
-			sql = a + " IS NULL"
-		} else {
-			sql = a + " IS NOT NULL"
-		}
-	} else {
-		sql = a + " " + e.op + " " + b
-	}
-	return
+func (d PostgresDialect) Capabilities() Capability {
+	return PostgresSyntax{}.Capabilities()
 }
 
-func (c *PostgresCtx) Column(col *ColumnExpr) (sql string, err error) {
-	return fmt.Sprintf(`"%s"."%s"`, col.table.Name(), col.column), nil
+func (d PostgresDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.dialect().Interpolate(e, v, convert)
 }
 
-func (c *PostgresCtx) Select(s *SelectExpr) (query string, err error) {
-	sql := []string{"SELECT"}
-	if s.distinct {
-		sql = append(sql, "DISTINCT")
-	}
-	if s.isSelectStar() {
-		sql = append(sql, "*")
-	} else {
-		columns := []string{}
-		for _, col := range s.columns {
-			sql, err := col.String(c)
-			if err != nil {
-				return "", err
-			}
-			columns = append(columns, sql)
-		}
-		sql = append(sql, strings.Join(columns, ", "))
-	}
-	if len(s.tables) > 0 {
-		tables := []string{}
-		for i, table := range s.tables {
-			tableSQL, err := table.String(c)
-			if err != nil {
-				return "", err
-			}
-			_, isJoin := table.(*JoinExpr)
-			if i > 0 && !isJoin { //	two tables without an explicit join condition
-				tableSQL = ", " + tableSQL
-			}
-			tables = append(tables, tableSQL)
-		}
-		sql = append(sql, "FROM", strings.Join(tables, " "))
-	}
-	if len(s.conditions) > 0 {
-		acc := s.conditions[0]
-		for _, condition := range s.conditions[1:] {
-			acc = acc.And(condition)
-		}
-		conditionSQL, err := acc.String(c)
-		if err != nil {
-			return "", err
-		}
-		sql = append(sql, "WHERE", conditionSQL)
-	}
-	if len(s.group) > 0 {
-		groups := []string{}
-		for _, g := range s.group {
-			group, err := g.String(c)
-			if err != nil {
-				return "", err
-			}
-			groups = append(groups, group)
-		}
-		sql = append(sql, "GROUP BY", strings.Join(groups, ", "))
-	}
-	if s.order != nil {
-		order, err := s.order.String(c)
-		if err != nil {
-			return "", nil
-		}
-		sql = append(sql, order)
-	}
-	if s.limit > 0 {
-		sql = append(sql, fmt.Sprintf("LIMIT %d", s.limit))
-	}
-	if s.offset > 0 {
-		sql = append(sql, fmt.Sprintf("OFFSET %d", s.offset))
-	}
-	return strings.Join(sql, " "), nil
+func (d PostgresDialect) Ctx() *PostgresCtx {
+	c := &PostgresCtx{BaseCtx{Syntax: PostgresSyntax{}, Pretty: d.Pretty}}
+	c.Self = c
+	return c
 }
 
-func (c *PostgresCtx) Alias(alias *AliasExpr) (sql string, err error) {
-	source, err := alias.Source.String(c)
-	if err != nil {
-		return
-	}
-	if alias.Source.IsCompound() {
-		source = "(" + source + ")"
-	}
-	sql = source + " AS " + alias.Name()
-	return
+// dialect returns the ctxDialect that does the work of d.
+func (d PostgresDialect) dialect() ctxDialect {
+	return ctxDialect{ctx: func() *BaseCtx { return &d.Ctx().BaseCtx }, DialectOptions: d.DialectOptions}
 }
 
-func (c *PostgresCtx) StaticPlaceholder(value interface{}) (sql string, err error) {
-	list, ok := value.([]interface{})
-	if ok {
-		strs := []string{}
-		for _, e := range list {
-			sql, err = c.StaticPlaceholder(e)
-			if err != nil {
-				return
-			}
-			strs = append(strs, sql)
-		}
-		sql = strings.Join(strs, ",")
-		return
-	}
-	c.placeholderValues = append(c.placeholderValues, value)
-	sql = fmt.Sprintf("$%d", len(c.placeholderValues))
-	return
+type PostgresCtx struct {
+	BaseCtx
 }
 
-func (c *PostgresCtx) DynamicPlaceholder(b *Binding) (sql string, err error) {
-	existing, ok := c.placeholderNameToIndexes[b.name]
-	if ok {
-		strs := []string{}
-		for _, i := range existing {
-			strs = append(strs, fmt.Sprintf("$%d", i))
-		}
-		sql = strings.Join(strs, ",")
-		return
-	}
-	bound := c.dynamicValues[b.name] // TODO: check for unbound arg
-	if bound == nil {
-		return "", nil // this will be ignored and formatted as IS NULL instead
-	}
-	v := reflect.ValueOf(bound)
-	if v.Kind() == reflect.Slice {
-		indexes := []int{}
-		strs := []string{}
-		for i := 0; i < v.Len(); i++ {
-			c.placeholderValues = append(c.placeholderValues, nil)
-			indexes = append(indexes, len(c.placeholderValues))
-			strs = append(strs, fmt.Sprintf("$%d", len(c.placeholderValues)))
-		}
-		c.placeholderNameToIndexes[b.name] = indexes
-		sql = strings.Join(strs, ",")
-		return
-	}
-	c.placeholderValues = append(c.placeholderValues, nil)
-	c.placeholderNameToIndexes[b.name] = []int{len(c.placeholderValues)}
-	sql = fmt.Sprintf("$%d", len(c.placeholderValues))
-	return
+// PostgresSyntax is the Syntax of PostgresDialect: numbered $n placeholders and :: casts.
+type PostgresSyntax struct {
+	DefaultSyntax
 }
 
-func (c *PostgresCtx) Join(j *JoinExpr) (sql string, err error) {
-	var join string
-	switch j.kind {
-	case InnerJoinKind:
-		join = "INNER JOIN"
-	case LeftJoinKind:
-		join = "LEFT JOIN"
-	case RightJoinKind:
-		join = "RIGHT JOIN"
-	case OuterJoinKind:
-		join = "OUTER JOIN"
-	}
-	tableSql, err := j.table.String(c)
-	if err != nil {
-		return "", err
-	}
-	conditionSql, err := j.condition.String(c)
-	if err != nil {
-		return "", err
-	}
-	return join + " " + tableSql + " " + conditionSql, nil
-}
+func (PostgresSyntax) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+func (PostgresSyntax) Positional() bool         { return false }
 
-func (c *PostgresCtx) JoinCondition(jc *JoinCondition) (sql string, err error) {
-	switch jc.kind {
-	case JoinOn:
-		sql, err := jc.condition.String(c)
-		if err != nil {
-			return "", err
-		}
-		return "ON (" + sql + ")", nil
-	case JoinUsing:
-		sql, err := jc.condition.String(c)
-		if err != nil {
-			return "", err
-		}
-		return "USING (" + sql + ")", nil
-	}
-	return "", fmt.Errorf("Could not use %v [%v] as a join condition", jc, reflect.TypeOf(jc))
+func (PostgresSyntax) Cast(sql, typ string) string {
+	return "(" + sql + ")::" + typ
 }
 
-func (c *PostgresCtx) In(in *InExpr) (sql string, err error) {
-	element, err := in.element.String(c)
-	if err != nil {
-		return "", err
-	}
-	list, err := in.list.String(c)
-	if err != nil {
-		return "", err
-	}
-	if in.list.IsCompound() {
-		list = "(" + list + ")"
-	}
-	return element + " IN " + list, nil
+func (PostgresSyntax) Capabilities() Capability {
+	return CapReturning | CapOnConflict | CapDistinctOn | CapFullJoin | CapILike | CapDistinctFrom | CapWindowFunctions
 }
 
-func (c *PostgresCtx) Cast(cast *CastExpr) (sql string, err error) {
-	sql, err = cast.e.String(c)
+// Literal writes bytea as '\x...'::bytea, times with their zone offset, and slices as ARRAY[...].
+func (s PostgresSyntax) Literal(value interface{}) (string, error) {
+	value, err := literalValue(value)
 	if err != nil {
-		return
-	}
-	sql = "(" + sql + ")::" + cast.typ
-	return
-}
-
-func (c *PostgresCtx) Func(f *FuncExpr) (sql string, err error) {
-	args := []string{}
-	for _, e := range f.values {
-		arg, err := e.String(c)
-		if err != nil {
-			return "", err
-		}
-		args = append(args, arg)
-	}
-	return f.name + "(" + strings.Join(args, ", ") + ")", nil
-}
-
-func (c *PostgresCtx) AggFunc(f *AggFuncExpr) (sql string, err error) {
-	if f.distinct && f.all {
-		return "", fmt.Errorf("an aggregate function cannot use both DISTINCT and ALL")
-	}
-	args := []string{}
-	for _, e := range f.values {
-		arg, err := e.String(c)
-		if err != nil {
-			return "", err
-		}
-		args = append(args, arg)
-	}
-	var qualifier string
-	if f.distinct {
-		qualifier = "DISTINCT "
+		return "", err
 	}
-	if f.all {
-		qualifier = "ALL "
+	switch v := value.(type) {
+	case []byte:
+		return `'\x` + hex.EncodeToString(v) + `'::bytea`, nil
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999Z07:00") + "'", nil
 	}
-	var order string
-	if f.order != nil {
-		order, err = f.order.String(c)
-		if err != nil {
-			return
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		if v.Len() == 0 {
+			return "'{}'", nil
 		}
-		order = " " + order
-	}
-	return f.name + "(" + qualifier + strings.Join(args, ", ") + order + ")", nil
-}
-
-func (c *PostgresCtx) OrderBy(order *OrderExpr) (sql string, err error) {
-	if len(order.exprs) == 0 {
-		return
-	}
-	parts := []string{}
-	for _, o := range order.exprs {
-		part, err := o.column.String(c)
-		if err != nil {
-			return "", err
-		}
-		if o.order == OrderAsc {
-			part += " ASC"
-		}
-		if o.order == OrderDesc {
-			part += " DESC"
+		elems := make([]string, v.Len())
+		for i := range elems {
+			if elems[i], err = s.Literal(v.Index(i).Interface()); err != nil {
+				return "", err
+			}
 		}
-		parts = append(parts, part)
+		return "ARRAY[" + strings.Join(elems, ",") + "]", nil
 	}
-	sql = "ORDER BY " + strings.Join(parts, ", ")
-	return
+	return s.DefaultSyntax.Literal(value)
 }
@@ -0,0 +1,204 @@
+package dbq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+Stmt is a query compiled once and executed repeatedly with different Args:
+
+	stmt, err := q.Prepare(ctx, q.Select().From("users").Where(Ident("id").Eq(Bind("id"))))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		var u User
+		if err := stmt.Into(&u, Args{"id": id}); err != nil {
+			return err
+		}
+	}
+
+Since bindings to nil and to slices change the SQL text (see Template), a Stmt keeps a separate compiled Template and *sql.Stmt for every shape of Args it is executed with.
+A Stmt is safe for concurrent use.
+*/
+type Stmt struct {
+	q      *Dbq
+	d      Compiler
+	e      Expression
+	mu     sync.Mutex
+	shapes map[string]*preparedShape
+}
+
+type preparedShape struct {
+	t    *Template
+	stmt *sql.Stmt
+}
+
+// Prepare returns a Stmt for e. If args are given, the statement is prepared for their shape right away; other shapes are prepared on first use.
+func (q *Dbq) Prepare(ctx context.Context, e Expression, args ...Args) (*Stmt, error) {
+	d, ok := q.Dialect.(Compiler)
+	if !ok {
+		return nil, fmt.Errorf("dbq: %T cannot compile templates, which Prepare requires", q.Dialect)
+	}
+	s := &Stmt{q: q, d: d, e: e, shapes: make(map[string]*preparedShape)}
+	if len(args) > 0 {
+		if _, err := s.shape(ctx, mergeArgs(args)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// argsShape returns a key identifying the SQL text that Args with the same keys, nil values and slice lengths as v produce.
+func argsShape(v Args) string {
+	var b strings.Builder
+	for _, k := range v.keys() {
+		b.WriteString(strconv.Quote(k))
+		value := v[k]
+		switch {
+		case value == nil:
+			b.WriteString("=nil")
+		case reflect.ValueOf(value).Kind() == reflect.Slice:
+			b.WriteString("=[" + strconv.Itoa(reflect.ValueOf(value).Len()) + "]")
+		}
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// shape returns the compiled form of the statement for the shape of v, preparing it if necessary.
+// Preparing is a round-trip to the database, so it happens outside the lock; if another goroutine prepared the same shape in the meantime, its statement is used and the duplicate is closed.
+func (s *Stmt) shape(ctx context.Context, v Args) (*preparedShape, error) {
+	key := argsShape(v)
+	s.mu.Lock()
+	closed := s.shapes == nil
+	p, ok := s.shapes[key]
+	s.mu.Unlock()
+	if closed {
+		return nil, errStmtClosed
+	}
+	if ok {
+		return p, nil
+	}
+
+	t, err := s.d.Compile(s.e, v)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := s.q.PrepareContext(ctx, t.SQL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shapes == nil {
+		stmt.Close()
+		return nil, errStmtClosed
+	}
+	if existing, ok := s.shapes[key]; ok {
+		stmt.Close()
+		return existing, nil
+	}
+	p = &preparedShape{t: t, stmt: stmt}
+	s.shapes[key] = p
+	return p, nil
+}
+
+var errStmtClosed = errors.New("dbq: statement is closed")
+
+// bind returns the prepared statement and the placeholder values for v.
+func (s *Stmt) bind(ctx context.Context, v Args) (*sql.Stmt, []interface{}, error) {
+	p, err := s.shape(ctx, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := p.t.Bind(v)
+	if err = s.q.convertValues(values); err != nil {
+		return nil, nil, err
+	}
+	return p.stmt, values, nil
+}
+
+// QueryContext executes the statement and returns the resulting rows.
+func (s *Stmt) QueryContext(ctx context.Context, args ...Args) (*sql.Rows, error) {
+	stmt, values, err := s.bind(ctx, mergeArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, values...)
+}
+
+// ExecContext executes a statement that does not return rows.
+func (s *Stmt) ExecContext(ctx context.Context, args ...Args) (sql.Result, error) {
+	stmt, values, err := s.bind(ctx, mergeArgs(args))
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, values...)
+}
+
+/*
+Into executes the statement and stores the result in target, like SelectQuery.Into().
+
+If the statement was prepared from a *SelectQuery, its scan mode and key column apply.
+Unlike SelectQuery.Into(), single-row targets do not limit the query, since that would change the SQL text; only the first row is read.
+*/
+func (s *Stmt) Into(target interface{}, args ...Args) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Into() expects a pointer")
+	}
+
+	mode, key := s.q.scanMode, ""
+	if query, ok := s.e.(*SelectQuery); ok {
+		mode, key = query.scanMode(), query.key
+	}
+	isMap := v.Elem().Kind() == reflect.Map && v.Elem().Type() != mapRowType
+	if isMap {
+		var err error
+		if key, err = s.q.mapKey(v, key); err != nil {
+			return err
+		}
+	}
+
+	rows, err := s.QueryContext(context.Background(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if v.Elem().Kind() == reflect.Slice {
+		return s.q.scanRows(v, rows, cols, mode)
+	} else if isMap {
+		return s.q.scanMap(v, rows, cols, key, mode)
+	} else {
+		_, err = s.q.scanSingleRow(v, rows, cols, mode, false)
+		return err
+	}
+}
+
+// Close releases all prepared statements. The Stmt cannot be used afterwards.
+func (s *Stmt) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.shapes {
+		if closeErr := p.stmt.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	s.shapes = nil
+	return
+}
@@ -0,0 +1,135 @@
+package dbq
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+/*
+Row is a dynamically typed result row, for queries whose shape is not known in advance.
+
+It can be used as a target of Into() and Iterator.Scan():
+
+	var rows []Row
+	err := q.Select().From("t").Into(&rows)
+
+Values are stored as returned by the driver, and the typed getters convert them using the same rules as database/sql.
+The getters return an error if the column does not exist or is NULL; use IsNull() to tell them apart.
+*/
+type Row struct {
+	cols   []string
+	index  map[string]int
+	values []interface{}
+}
+
+// columnIndex maps column names to their positions. If a name is repeated, the first occurrence wins.
+func columnIndex(cols []string) map[string]int {
+	index := make(map[string]int, len(cols))
+	for i, col := range cols {
+		if _, exists := index[col]; !exists {
+			index[col] = i
+		}
+	}
+	return index
+}
+
+// Columns returns the column names, in result order.
+func (r Row) Columns() []string { return r.cols }
+
+// Values returns the column values, in result order.
+func (r Row) Values() []interface{} { return r.values }
+
+// Map returns the row as a map from column names to values.
+func (r Row) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(r.cols))
+	for i, col := range r.cols {
+		if _, exists := m[col]; !exists {
+			m[col] = r.values[i]
+		}
+	}
+	return m
+}
+
+// Value returns the raw value of a column.
+func (r Row) Value(col string) (value interface{}, ok bool) {
+	i, ok := r.index[col]
+	if !ok {
+		return nil, false
+	}
+	return r.values[i], true
+}
+
+// IsNull reports whether a column exists and is NULL.
+func (r Row) IsNull(col string) bool {
+	v, ok := r.Value(col)
+	return ok && v == nil
+}
+
+// get looks up a column and scans it into dest. valid must report whether dest received a non-NULL value.
+func (r Row) get(col string, dest sql.Scanner, valid func() bool) error {
+	v, ok := r.Value(col)
+	if !ok {
+		return fmt.Errorf("no column %s in row", col)
+	}
+	if err := dest.Scan(v); err != nil {
+		return fmt.Errorf("column %s: %v", col, err)
+	}
+	if !valid() {
+		return fmt.Errorf("column %s is NULL", col)
+	}
+	return nil
+}
+
+// Int64 returns the value of a column as an int64.
+func (r Row) Int64(col string) (int64, error) {
+	var v sql.NullInt64
+	err := r.get(col, &v, func() bool { return v.Valid })
+	return v.Int64, err
+}
+
+// Float64 returns the value of a column as a float64.
+func (r Row) Float64(col string) (float64, error) {
+	var v sql.NullFloat64
+	err := r.get(col, &v, func() bool { return v.Valid })
+	return v.Float64, err
+}
+
+// String returns the value of a column as a string.
+func (r Row) String(col string) (string, error) {
+	var v sql.NullString
+	err := r.get(col, &v, func() bool { return v.Valid })
+	return v.String, err
+}
+
+// Bool returns the value of a column as a bool.
+func (r Row) Bool(col string) (bool, error) {
+	var v sql.NullBool
+	err := r.get(col, &v, func() bool { return v.Valid })
+	return v.Bool, err
+}
+
+// Time returns the value of a column as a time.Time.
+func (r Row) Time(col string) (time.Time, error) {
+	var v sql.NullTime
+	err := r.get(col, &v, func() bool { return v.Valid })
+	return v.Time, err
+}
+
+// Bytes returns the value of a column as a byte slice.
+func (r Row) Bytes(col string) ([]byte, error) {
+	v, ok := r.Value(col)
+	if !ok {
+		return nil, fmt.Errorf("no column %s in row", col)
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("column %s is NULL", col)
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("column %s: cannot convert %T to []byte", col, v)
+	}
+}
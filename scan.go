@@ -0,0 +1,476 @@
+package dbq
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+func isScannable(t reflect.Type) bool {
+	iface := reflect.Zero(t).Interface()
+	_, isBuffer := iface.([]byte)
+	_, isTime := iface.(time.Time)
+	return reflect.PtrTo(t).Implements(scannerType) || isBuffer || isTime
+}
+
+func isScalar(t reflect.Type) bool {
+	if isScannable(t) {
+		return true
+	}
+	k := t.Kind()
+	return !(k == reflect.Array || k == reflect.Chan || k == reflect.Func || k == reflect.Interface ||
+		k == reflect.Map || k == reflect.Slice || k == reflect.Struct ||
+		k == reflect.Uintptr || k == reflect.UnsafePointer)
+}
+
+type scanKind int
+
+const (
+	scanKindScalar scanKind = iota
+	scanKindStruct
+	scanKindMap // map[string]interface{}
+	scanKindRow // Row
+	scanKindArray
+	scanKindTuple
+)
+
+var (
+	mapRowType = reflect.TypeOf(map[string]interface{}{})
+	rowType    = reflect.TypeOf(Row{})
+)
+
+// rowScanner stores the rows of a result set into values of a particular type.
+// It is prepared once per result set, so that per-row scanning does not need to inspect the target type.
+type rowScanner struct {
+	cols  []string
+	kind  scanKind
+	alloc reflect.Type   // for *T targets with composite T: the type to allocate
+	pos   int            // the column position for scalar targets
+	paths [][]int        // field indexes for struct targets, as returned by structMap.paths()
+	ptrs  [][]int        // the indexes of pointer-to-struct fields in struct targets
+	index map[string]int // column positions for Row targets
+	opts  scanOptions
+}
+
+// scanOptions carries the settings that affect how individual values are stored.
+type scanOptions struct {
+	mode       ScanMode
+	converters map[reflect.Type]Converter
+}
+
+func (q *Dbq) scanOptions(mode ScanMode) scanOptions {
+	return scanOptions{mode: mode, converters: q.converters.snapshot()}
+}
+
+// rowScanner prepares scanning rows with the columns cols into values of type t.
+func (q *Dbq) rowScanner(t reflect.Type, cols []string, mode ScanMode) (*rowScanner, error) {
+	return q.keyedRowScanner(t, cols, -1, mode)
+}
+
+// keyedRowScanner is like rowScanner, but excludes the column at position key from scalar targets, as it is scanned separately as a map key.
+func (q *Dbq) keyedRowScanner(t reflect.Type, cols []string, key int, mode ScanMode) (sc *rowScanner, err error) {
+	sc = &rowScanner{cols: cols, opts: q.scanOptions(mode)}
+	if t.Kind() == reflect.Ptr && isComposite(t.Elem()) && !hasConverter(sc.opts.converters, t) {
+		t = t.Elem()
+		sc.alloc = t
+	}
+	switch {
+	case t == rowType:
+		sc.kind = scanKindRow
+		sc.index = columnIndex(cols)
+	case t == mapRowType:
+		sc.kind = scanKindMap
+	case isScalar(t) || hasConverter(sc.opts.converters, t):
+		sc.kind = scanKindScalar
+		if key == 0 {
+			sc.pos = 1
+		}
+		err = checkScalar(t, cols, key, mode)
+	case t.Kind() == reflect.Array:
+		sc.kind = scanKindArray
+		if mode&ScanStrictColumns != 0 && t.Len() != len(cols) {
+			err = fmt.Errorf("cannot scan %d columns into %v", len(cols), t)
+		}
+	case isTuple(t):
+		sc.kind = scanKindTuple
+		fields := tupleFields(t)
+		if mode&ScanStrictColumns != 0 && len(fields) != len(cols) {
+			err = fmt.Errorf("cannot scan %d columns into %v", len(cols), t)
+		}
+		// columns beyond the last field get nil entries and are discarded
+		sc.paths = make([][]int, len(cols))
+		copy(sc.paths, fields)
+	case t.Kind() == reflect.Struct:
+		sc.kind = scanKindStruct
+		m := q.structMap(t)
+		err = m.check(t, cols, mode)
+		sc.paths = m.paths(cols)
+		sc.ptrs = m.ptrs
+	default:
+		err = fmt.Errorf("cannot scan into %v: only scalars, structs, Row and map[string]interface{} are implemented", t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// isComposite reports whether t is scanned from multiple columns.
+func isComposite(t reflect.Type) bool {
+	return t == mapRowType || t.Kind() == reflect.Array || (t.Kind() == reflect.Struct && !isScannable(t))
+}
+
+/*
+Tuple is a marker to be embedded into structs that should be scanned by column position instead of name:
+
+	var pairs []struct {
+		Tuple
+		ID   int64
+		Name string
+	}
+	err := q.Select("id", "name").From("users").Into(&pairs)
+
+The exported fields of a tuple struct receive the result columns in order; tags are ignored.
+*/
+type Tuple struct{}
+
+var tupleType = reflect.TypeOf(Tuple{})
+
+func isTuple(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous && f.Type == tupleType {
+			return true
+		}
+	}
+	return false
+}
+
+// tupleFields returns the indexes of the exported fields of the tuple struct t, in order.
+func tupleFields(t reflect.Type) (fields [][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Type == tupleType {
+			continue
+		}
+		fields = append(fields, f.Index)
+	}
+	return
+}
+
+// scan stores the current row in v, which must be a pointer to the target type.
+func (sc *rowScanner) scan(rows *sql.Rows, v reflect.Value) error {
+	if sc.alloc != nil {
+		target := reflect.New(sc.alloc)
+		if err := sc.scanInto(rows, target); err != nil {
+			return err
+		}
+		v.Elem().Set(target)
+		return nil
+	}
+	return sc.scanInto(rows, v)
+}
+
+func (sc *rowScanner) scanInto(rows *sql.Rows, v reflect.Value) error {
+	switch sc.kind {
+	case scanKindStruct, scanKindTuple:
+		return scanStruct(v, rows, sc.paths, sc.ptrs, sc.opts)
+	case scanKindArray:
+		elems := make([]reflect.Value, v.Elem().Len())
+		for i := range elems {
+			elems[i] = v.Elem().Index(i).Addr()
+		}
+		return scanColumns(rows, len(sc.cols), elems, sc.opts)
+	case scanKindMap:
+		values, err := scanValues(rows, len(sc.cols))
+		if err != nil {
+			return err
+		}
+		m := make(map[string]interface{}, len(sc.cols))
+		for i, col := range sc.cols {
+			m[col] = values[i]
+		}
+		v.Elem().Set(reflect.ValueOf(m))
+		return nil
+	case scanKindRow:
+		values, err := scanValues(rows, len(sc.cols))
+		if err != nil {
+			return err
+		}
+		v.Elem().Set(reflect.ValueOf(Row{cols: sc.cols, index: sc.index, values: values}))
+		return nil
+	default:
+		return scanScalar(v, rows, len(sc.cols), sc.pos, sc.opts)
+	}
+}
+
+// scanValues returns the current row as driver values.
+func scanValues(rows *sql.Rows, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	acceptors := make([]interface{}, n)
+	for i := range values {
+		acceptors[i] = &values[i]
+	}
+	return values, rows.Scan(acceptors...)
+}
+
+// discard returns a scan destination that accepts and ignores any value.
+func discard() interface{} {
+	return new(interface{})
+}
+
+// v: pointer to scalar
+// n: number of columns
+// pos: the column to store in v
+func scanScalar(v reflect.Value, rows *sql.Rows, n, pos int, opts scanOptions) (err error) {
+	acceptors := make([]interface{}, n)
+	for i := range acceptors {
+		acceptors[i] = discard()
+	}
+	acceptor, fixup := acceptorFor(v.Elem(), opts)
+	acceptors[pos] = acceptor
+	err = rows.Scan(acceptors...)
+	if err == nil && fixup != nil {
+		fixup()
+	}
+	return
+}
+
+// scanColumns stores the first len(targets) of n columns in targets, which must be pointers to scalars. Excess targets are left untouched.
+func scanColumns(rows *sql.Rows, n int, targets []reflect.Value, opts scanOptions) (err error) {
+	acceptors := make([]interface{}, n)
+	var fixups []func()
+	for i := range acceptors {
+		if i >= len(targets) {
+			acceptors[i] = discard()
+			continue
+		}
+		acceptor, fixup := acceptorFor(targets[i].Elem(), opts)
+		acceptors[i] = acceptor
+		if fixup != nil {
+			fixups = append(fixups, fixup)
+		}
+	}
+	err = rows.Scan(acceptors...)
+	if err == nil {
+		for _, fixup := range fixups {
+			fixup()
+		}
+	}
+	return
+}
+
+// v: pointer to struct
+// paths: field indexes for each column, as returned by structMap.paths()
+// ptrs: field indexes of the pointer-to-struct fields, as in structMap.ptrs
+//
+// Pointer-to-struct fields are set to a new struct if any column under them is not NULL, and to nil otherwise.
+func scanStruct(v reflect.Value, rows *sql.Rows, paths, ptrs [][]int, opts scanOptions) (err error) {
+	str := v.Elem()
+	// the struct to allocate for each pointer, and the innermost pointer each pointer and column is under, or -1
+	fresh := make([]reflect.Value, len(ptrs))
+	outer := make([]int, len(ptrs))
+	for j, ptr := range ptrs {
+		outer[j] = innermost(ptrs[:j], ptr)
+		fresh[j] = reflect.New(fieldOf(str, fresh, ptrs, outer[j], ptr).Type().Elem())
+	}
+	acceptors := make([]interface{}, len(paths))
+	var fixups []func()
+	under := make([]int, len(paths))
+	nulls := make([]func() (bool, error), len(paths))
+	for i, path := range paths {
+		if path == nil {
+			acceptors[i] = discard()
+			continue
+		}
+		under[i] = innermost(ptrs, path)
+		dest := fieldOf(str, fresh, ptrs, under[i], path)
+		if under[i] >= 0 {
+			acceptors[i], nulls[i] = nullableAcceptorFor(dest, i, opts)
+			continue
+		}
+		acceptor, fixup := acceptorFor(dest, opts)
+		acceptors[i] = acceptor
+		if fixup != nil {
+			fixups = append(fixups, fixup)
+		}
+	}
+	err = rows.Scan(acceptors...)
+	if err != nil {
+		return
+	}
+	for _, fixup := range fixups {
+		fixup()
+	}
+	if len(ptrs) == 0 {
+		return
+	}
+
+	used := make([]bool, len(ptrs))
+	errs := make([]error, len(ptrs)) // NULLs in plain fields, which only matter if the pointer is allocated
+	for i, null := range nulls {
+		if null == nil {
+			continue
+		}
+		isNull, nullErr := null()
+		if !isNull {
+			for j := under[i]; j >= 0 && !used[j]; j = outer[j] {
+				used[j] = true
+			}
+		} else if errs[under[i]] == nil {
+			errs[under[i]] = nullErr
+		}
+	}
+	for j, ptr := range ptrs {
+		if used[j] && errs[j] != nil {
+			return errs[j]
+		}
+		field := fieldOf(str, fresh, ptrs, outer[j], ptr)
+		if used[j] {
+			field.Set(fresh[j])
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+	return
+}
+
+// innermost returns the position of the longest of ptrs that path starts with, or -1 if there is none.
+func innermost(ptrs [][]int, path []int) int {
+	found := -1
+	for j, ptr := range ptrs {
+		if len(ptr) < len(path) && (found < 0 || len(ptr) > len(ptrs[found])) && startsWith(path, ptr) {
+			found = j
+		}
+	}
+	return found
+}
+
+func startsWith(path, prefix []int) bool {
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldOf returns the field at path in str, or in fresh[j] if path is under ptrs[j].
+func fieldOf(str reflect.Value, fresh []reflect.Value, ptrs [][]int, j int, path []int) reflect.Value {
+	if j < 0 {
+		return str.FieldByIndex(path)
+	}
+	return fresh[j].Elem().FieldByIndex(path[len(ptrs[j]):])
+}
+
+// nullableAcceptorFor is like acceptorFor, but for a column that decides whether the pointer-to-struct field containing dest is allocated.
+// The returned function, to be called after a successful scan, completes the assignment and reports whether the column was NULL,
+// along with the error to return for it if the pointer is allocated anyway.
+func nullableAcceptorFor(dest reflect.Value, pos int, opts scanOptions) (acceptor interface{}, fixup func() (bool, error)) {
+	if sc, ok := convertingScannerFor(opts.converters, dest); ok {
+		rec := &nullRecorder{Scanner: sc}
+		return rec, func() (bool, error) { return rec.null, nil }
+	}
+	// scan into a **T, which database/sql sets to nil on NULL and allocates otherwise
+	holder := reflect.New(reflect.PtrTo(dest.Type()))
+	return holder.Interface(), func() (bool, error) {
+		if ptr := holder.Elem(); !ptr.IsNil() {
+			dest.Set(ptr.Elem())
+			return false, nil
+		}
+		if opts.mode&ScanNullAsZero == 0 && isPlain(dest.Type()) {
+			return true, fmt.Errorf("sql: Scan error on column index %d: converting NULL to %v is unsupported", pos, dest.Type())
+		}
+		return true, nil
+	}
+}
+
+// nullRecorder notes whether the value passed to a sql.Scanner was NULL.
+type nullRecorder struct {
+	sql.Scanner
+	null bool
+}
+
+func (r *nullRecorder) Scan(src interface{}) error {
+	r.null = src == nil
+	return r.Scanner.Scan(src)
+}
+
+// ScanMode is a set of flags that control how Into() stores query results.
+type ScanMode int
+
+const (
+	// ScanNullAsZero makes NULL values scanned into plain fields and variables (those that are neither pointers nor sql.Scanners) leave the zero value in them instead of failing.
+	// Pointers are always set to nil on NULL and allocated otherwise, regardless of the mode.
+	ScanNullAsZero ScanMode = 1 << iota
+	// ScanStrictColumns makes Into() fail with a *MappingError if a result column does not correspond to any struct field.
+	// For scalar targets, this means the result must have exactly one column.
+	ScanStrictColumns
+	// ScanStrictFields makes Into() fail with a *MappingError if a struct field is not filled by any result column.
+	// Fields can be exempted with the optional tag option:
+	//	Note string `db:"note,optional"`
+	ScanStrictFields
+	// ScanStrict is a shorthand for ScanStrictColumns|ScanStrictFields.
+	ScanStrict = ScanStrictColumns | ScanStrictFields
+)
+
+// SetScanMode changes the ScanMode used by Into().
+func (q *Dbq) SetScanMode(mode ScanMode) *Dbq {
+	q.scanMode = mode
+	return q
+}
+
+// checkScalar verifies that cols, excluding the one at position key, can be scanned into a scalar of type t: there must be a column left, and with ScanStrictColumns only one.
+func checkScalar(t reflect.Type, cols []string, key int, mode ScanMode) error {
+	var values []string
+	for i, col := range cols {
+		if i != key {
+			values = append(values, col)
+		}
+	}
+	if len(values) == 0 {
+		// e.g. only the key column of a map; there is nothing to scan the value from in any mode
+		return &MappingError{Type: t, UnfilledFields: []string{"value"}}
+	}
+	if mode&ScanStrictColumns == 0 {
+		return nil
+	}
+	if len(values) > 1 {
+		return &MappingError{Type: t, UnmappedColumns: values[1:]}
+	}
+	return nil
+}
+
+// acceptorFor returns a value that can be passed to rows.Scan() to store a column in dest, which must be addressable.
+// If the returned function is not nil, it needs to be called after a successful scan to complete the assignment.
+func acceptorFor(dest reflect.Value, opts scanOptions) (acceptor interface{}, fixup func()) {
+	if sc, ok := convertingScannerFor(opts.converters, dest); ok {
+		return sc, nil
+	}
+	if opts.mode&ScanNullAsZero == 0 || !isPlain(dest.Type()) {
+		return dest.Addr().Interface(), nil
+	}
+	// scan into a **T, which database/sql sets to nil on NULL and allocates otherwise
+	holder := reflect.New(reflect.PtrTo(dest.Type()))
+	return holder.Interface(), func() {
+		if ptr := holder.Elem(); ptr.IsNil() {
+			dest.Set(reflect.Zero(dest.Type()))
+		} else {
+			dest.Set(ptr.Elem())
+		}
+	}
+}
+
+// isPlain reports whether t cannot represent NULL on its own.
+func isPlain(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(scannerType)
+}
@@ -1,23 +1,28 @@
 package dbq
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
-	"strings"
-	"time"
 )
 
 // SelectQuery is a higher-level interface to SelectExpr.
+//
+// SelectQuery values are immutable: every builder method returns a modified copy and leaves the receiver unchanged.
+// This makes it safe to derive variants from a common base query, and to share queries between goroutines.
 type SelectQuery struct {
 	Expr
-	q           *Dbq
-	singleClone *SelectQuery
+	q    *Dbq
+	mode *ScanMode
+	key  string
 }
 
 // SelectExpr represents a SELECT query.
 type SelectExpr struct {
 	distinct      bool
+	distinctOn    []Expression
 	columns       []Node
 	tables        []Node
 	conditions    []Expression
@@ -27,8 +32,15 @@ type SelectExpr struct {
 	Compound
 }
 
+// clone returns a copy of the expression that does not share any mutable state with the original.
+// The Nodes themselves are not copied, since they are immutable.
 func (s *SelectExpr) clone() *SelectExpr {
 	cl := *s
+	cl.distinctOn = append([]Expression(nil), s.distinctOn...)
+	cl.columns = append([]Node(nil), s.columns...)
+	cl.tables = append([]Node(nil), s.tables...)
+	cl.conditions = append([]Expression(nil), s.conditions...)
+	cl.group = append([]Expression(nil), s.group...)
 	return &cl
 }
 
@@ -43,7 +55,7 @@ spec is a column specification. An element can be of types:
 	string   // interpreted as a column name
 	Node     // used as is
 	Distinct
-
+	DistinctOnClause // created with DistinctOn()
 */
 func (q *Dbq) Select(spec ...interface{}) *SelectQuery {
 	node := &SelectExpr{}
@@ -58,6 +70,8 @@ func (s *SelectExpr) parseSelect(specs []interface{}) {
 			s.columns = append(s.columns, Ident(spec))
 		case Distinct:
 			s.distinct = true
+		case DistinctOnClause:
+			s.distinctOn = append(s.distinctOn, spec.exprs...)
 		case Expression:
 			s.columns = append(s.columns, spec)
 		}
@@ -72,8 +86,40 @@ func (s *SelectQuery) expr() *SelectExpr {
 	return s.Expr.Node.(*SelectExpr)
 }
 
+// Clone returns a deep copy of the query.
+func (s *SelectQuery) Clone() *SelectQuery {
+	cl, _ := s.derive()
+	return cl
+}
+
+// derive returns a copy of the query to be modified by a builder method, along with its expression.
+func (s *SelectQuery) derive() (*SelectQuery, *SelectExpr) {
+	ex := s.expr().clone()
+	cl := *s
+	cl.Expr = Expr{Node: ex}
+	return &cl, ex
+}
+
 func (s *SelectExpr) isSelectStar() bool { return len(s.columns) == 0 }
 
+// The accessors of SelectExpr return copies of the clauses, so that they can be modified freely, e.g. in Rewrite().
+
+func (s *SelectExpr) Distinct() bool              { return s.distinct }
+func (s *SelectExpr) DistinctOn() []Expression    { return append([]Expression(nil), s.distinctOn...) }
+func (s *SelectExpr) Columns() []Node             { return append([]Node(nil), s.columns...) } // empty for SELECT *
+func (s *SelectExpr) Tables() []Node              { return append([]Node(nil), s.tables...) }
+func (s *SelectExpr) Conditions() []Expression    { return append([]Expression(nil), s.conditions...) }
+func (s *SelectExpr) Group() []Expression         { return append([]Expression(nil), s.group...) }
+func (s *SelectExpr) Order() Node                 { return s.order } // the ORDER BY clause, or nil
+func (s *SelectExpr) Limit() (limit, offset uint) { return s.limit, s.offset }
+
+// Where returns a copy of the expression with additional conditions, like SelectQuery.Where() without the shortcuts.
+func (s *SelectExpr) Where(conditions ...Expression) *SelectExpr {
+	cl := s.clone()
+	cl.conditions = append(cl.conditions, conditions...)
+	return cl
+}
+
 type JoinKind int
 
 const (
@@ -133,12 +179,16 @@ func OuterJoin(table interface{}, condition *JoinCondition) *JoinExpr {
 	return &JoinExpr{kind: OuterJoinKind, table: joinTable(table), condition: condition}
 }
 
+// CrossJoin returns a join without a condition, which combines every row of the joined table with every row of the others.
+func CrossJoin(table interface{}) *JoinExpr {
+	return &JoinExpr{kind: CrossJoinKind, table: joinTable(table)}
+}
+
 func On(condition Node) *JoinCondition {
 	return &JoinCondition{kind: JoinOn, condition: condition}
 }
 
-// TODO: can USING take multiple columns?
-
+// Using joins on the columns of condition, which is a column name, or a list of them as created by Parse().
 func Using(condition Node) *JoinCondition {
 	return &JoinCondition{kind: JoinUsing, condition: condition}
 }
@@ -147,12 +197,19 @@ func (jc *JoinExpr) String(c Ctx) (string, error) {
 	return c.Join(jc)
 }
 
+func (jc *JoinExpr) Kind() JoinKind  { return jc.kind }
+func (jc *JoinExpr) Table() Node     { return jc.table }
+func (jc *JoinExpr) Condition() Node { return jc.condition } // a *JoinCondition, or nil
+
 func (jc *JoinCondition) String(c Ctx) (string, error) {
 	return c.JoinCondition(jc)
 }
 
+func (jc *JoinCondition) Kind() JoinConditionKind { return jc.kind }
+func (jc *JoinCondition) Condition() Node         { return jc.condition }
+
 func (s *SelectQuery) From(specs ...interface{}) *SelectQuery {
-	ex := s.expr()
+	s, ex := s.derive()
 	for _, spec := range specs {
 		switch spec := spec.(type) {
 		case string:
@@ -171,30 +228,37 @@ func (s *SelectQuery) From(specs ...interface{}) *SelectQuery {
 }
 
 func (s *SelectQuery) Where(specs ...interface{}) *SelectQuery {
-	ex := s.expr()
+	s, ex := s.derive()
+	ex.conditions = append(ex.conditions, conditionSpecs(specs)...)
+	return s
+}
+
+// conditionSpecs converts the arguments of Where(): Args become comparisons of their keys with their values, and Expressions are used as they are.
+func conditionSpecs(specs []interface{}) (conditions []Expression) {
 	for _, spec := range specs {
 		switch spec := spec.(type) {
 		case Args:
-			for ident, value := range spec {
+			for _, ident := range spec.keys() {
+				value := spec[ident]
 				col := Ident(ident)
 				if reflect.ValueOf(value).Kind() == reflect.Slice {
-					ex.conditions = append(ex.conditions, col.In(value))
+					conditions = append(conditions, col.In(value))
 				} else {
-					ex.conditions = append(ex.conditions, col.Eq(value))
+					conditions = append(conditions, col.Eq(value))
 				}
 
 			}
 		case Expression:
-			ex.conditions = append(ex.conditions, spec)
+			conditions = append(conditions, spec)
 		default:
 			panic(fmt.Errorf("Cannot use %v [%v] as a condition", spec, reflect.TypeOf(spec)))
 		}
 	}
-	return s
+	return
 }
 
 func (s *SelectQuery) Group(exprs ...interface{}) *SelectQuery {
-	ex := s.expr()
+	s, ex := s.derive()
 	for _, e := range exprs {
 		switch e := e.(type) {
 		case string:
@@ -209,175 +273,377 @@ func (s *SelectQuery) Group(exprs ...interface{}) *SelectQuery {
 }
 
 func (s *SelectQuery) Limit(l uint) *SelectQuery {
-	ex := s.expr()
+	s, ex := s.derive()
 	ex.limit = l
 	return s
 }
 
 func (s *SelectQuery) Offset(o uint) *SelectQuery {
-	ex := s.expr()
+	s, ex := s.derive()
 	ex.offset = o
 	return s
 }
 
 func (s *SelectQuery) OrderBy(clauses ...interface{}) *SelectQuery {
-	s.expr().order = OrderBy(clauses...)
+	s, ex := s.derive()
+	ex.order = OrderBy(clauses...)
 	return s
 }
 
-func isScannable(t reflect.Type) bool {
-	iface := reflect.Zero(t).Interface()
-	_, isScanner := iface.(sql.Scanner)
-	_, isBuffer := iface.([]byte)
-	_, isTime := iface.(time.Time)
-	return isScanner || isBuffer || isTime
+func (s *SelectQuery) Into(target interface{}, args ...Args) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Into() expects a pointer")
+	}
+
+	arg := mergeArgs(args)
+	mode := s.scanMode()
+	if v.Elem().Kind() == reflect.Slice {
+		return s.selectRows(v, arg, mode)
+	} else if v.Elem().Kind() == reflect.Map && v.Elem().Type() != mapRowType {
+		return s.selectMap(v, arg, mode)
+	} else {
+		_, err := s.limited(1).selectSingleRow(v, arg, mode, false)
+		return err
+	}
 }
 
-//	TODO: support []byte and time.Time
+// ErrTooManyRows is returned by One() and OneOrNone() when the query returns more than one row.
+var ErrTooManyRows = errors.New("dbq: more than one row in result")
 
-func isScalar(t reflect.Type) bool {
-	if isScannable(t) {
-		return true
+// First executes the query and stores the first row of the result in target, which can be anything accepted by Iterator.Scan().
+// It returns sql.ErrNoRows if the result is empty.
+//
+// The query is limited to one row; the SelectQuery itself is not modified.
+func (s *SelectQuery) First(target interface{}, args ...Args) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("First() expects a pointer")
 	}
-	k := t.Kind()
-	return !(k == reflect.Array || k == reflect.Chan || k == reflect.Func || k == reflect.Interface ||
-		k == reflect.Map || k == reflect.Slice || k == reflect.Struct ||
-		k == reflect.Uintptr || k == reflect.UnsafePointer)
+	_, err := s.limited(1).selectSingleRow(v, mergeArgs(args), s.scanMode(), false)
+	return err
 }
 
-func (s *SelectQuery) Into(target interface{}, args ...Args) error {
+// One is like First(), but returns ErrTooManyRows if the query returns more than one row, in which case target is not modified.
+func (s *SelectQuery) One(target interface{}, args ...Args) error {
 	v := reflect.ValueOf(target)
 	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("Into() expects a pointer")
+		return fmt.Errorf("One() expects a pointer")
+	}
+	_, err := s.limited(2).selectSingleRow(v, mergeArgs(args), s.scanMode(), true)
+	return err
+}
+
+// OneOrNone is like One(), but an empty result is not an error: it returns false and leaves target untouched instead.
+func (s *SelectQuery) OneOrNone(target interface{}, args ...Args) (found bool, err error) {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr {
+		return false, fmt.Errorf("OneOrNone() expects a pointer")
+	}
+	found, err = s.limited(2).selectSingleRow(v, mergeArgs(args), s.scanMode(), true)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return
+}
+
+// limited returns a copy of the query that returns at most n rows.
+func (s *SelectQuery) limited(n uint) *SelectQuery {
+	s, ex := s.derive()
+	if ex.limit == 0 || ex.limit > n {
+		ex.limit = n
+	}
+	return s
+}
+
+/*
+IntoColumns executes the query and stores each result column in a separate target, by position.
+
+If all targets are pointers to slices of scalars, every row appends one element to each of them, producing parallel slices:
+
+	var ids []int64
+	var names []string
+	err := q.Select("id", "name").From("users").IntoColumns(&ids, &names)
+
+If all targets are pointers to scalars, they receive the columns of the first row, as with *sql.Row.Scan().
+
+Args values among the targets are merged and used as bindings, as in Into().
+*/
+func (s *SelectQuery) IntoColumns(targets ...interface{}) error {
+	args := []Args{}
+	values := []reflect.Value{}
+	for _, target := range targets {
+		if a, ok := target.(Args); ok {
+			args = append(args, a)
+			continue
+		}
+		v := reflect.ValueOf(target)
+		if v.Kind() != reflect.Ptr {
+			return fmt.Errorf("IntoColumns() expects pointers")
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("IntoColumns() expects at least one target")
+	}
+
+	converters := s.q.converters.snapshot()
+	slices := 0
+	for _, v := range values {
+		t := v.Type().Elem()
+		if t.Kind() == reflect.Slice && !isScannable(t) && !hasConverter(converters, t) {
+			t = t.Elem()
+			slices++
+		}
+		if !isScalar(t) && !hasConverter(converters, t) {
+			return fmt.Errorf("IntoColumns() expects scalar targets, got %v", v.Type())
+		}
+	}
+	if slices != 0 && slices != len(values) {
+		return fmt.Errorf("IntoColumns() cannot mix slice and single-row targets")
+	}
+
+	query := s
+	if slices == 0 {
+		query = s.limited(1)
+	}
+	rows, cols, err := query.execute(context.Background(), mergeArgs(args))
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
+	mode := s.scanMode()
+	opts := s.q.scanOptions(mode)
+	if len(values) > len(cols) || (mode&ScanStrictColumns != 0 && len(values) < len(cols)) {
+		return fmt.Errorf("IntoColumns() got %d targets for %d columns", len(values), len(cols))
+	}
+
+	scannedAny := false
+	for rows.Next() {
+		scannedAny = true
+		if slices == 0 {
+			err = scanColumns(rows, len(cols), values, opts)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		elems := make([]reflect.Value, len(values))
+		for i, v := range values {
+			elems[i] = reflect.New(v.Type().Elem().Elem())
+		}
+		if err = scanColumns(rows, len(cols), elems, opts); err != nil {
+			return err
+		}
+		for i, v := range values {
+			v.Elem().Set(reflect.Append(v.Elem(), elems[i].Elem()))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if slices == 0 && !scannedAny {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// mergeArgs combines multiple sets of bindings, with later ones taking precedence.
+func mergeArgs(args []Args) Args {
 	arg := Args{}
 	for _, a := range args {
 		for k, v := range a {
 			arg[k] = v
 		}
 	}
+	return arg
+}
 
-	if v.Elem().Kind() == reflect.Slice {
-		return s.selectRows(v, arg)
-	} else {
-		if s.singleClone == nil {
-			s.singleClone = &SelectQuery{Expr: Expr{Node: s.expr().clone()}, q: s.q}
-			s.singleClone.Limit(1)
-		}
-		return s.singleClone.selectSingleRow(v, arg)
-	}
+// ScanMode overrides the ScanMode of the *Dbq for this query.
+func (s *SelectQuery) ScanMode(mode ScanMode) *SelectQuery {
+	cl := *s
+	cl.mode = &mode
+	return &cl
 }
 
-func (s *SelectQuery) selectRows(v reflect.Value, arg Args) error {
-	targetType := v.Type().Elem().Elem()
-	isStruct := targetType.Kind() == reflect.Struct
-	isSc := isScalar(targetType)
-	if !isStruct && !isSc {
-		return fmt.Errorf("only scalars and structs are implemented")
+func (s *SelectQuery) scanMode() ScanMode {
+	if s.mode != nil {
+		return *s.mode
 	}
+	return s.q.scanMode
+}
 
-	rows, cols, err := s.execute(arg)
+func (s *SelectQuery) selectRows(v reflect.Value, arg Args, mode ScanMode) error {
+	rows, cols, err := s.execute(context.Background(), arg)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
+	return s.q.scanRows(v, rows, cols, mode)
+}
+
+// v: pointer to a slice
+func (q *Dbq) scanRows(v reflect.Value, rows *sql.Rows, cols []string, mode ScanMode) error {
+	targetType := v.Type().Elem().Elem()
+
+	sc, err := q.rowScanner(targetType, cols, mode)
+	if err != nil {
+		return err
+	}
 
 	targetSlice := v.Elem()
 
 	for rows.Next() {
 		acceptor := reflect.New(targetType)
-		if isSc {
-			err = scanScalar(acceptor, rows, cols)
-		} else if isStruct {
-			err = scanStruct(acceptor, rows, cols)
-		}
-		if err != nil {
+		if err = sc.scan(rows, acceptor); err != nil {
 			return err
 		}
 		targetSlice = reflect.Append(targetSlice, acceptor.Elem())
 	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
 	v.Elem().Set(targetSlice)
 	return nil
 
 }
 
-func (s *SelectQuery) selectSingleRow(v reflect.Value, arg Args) error {
-	isStruct := v.Elem().Kind() == reflect.Struct
-	isSc := isScalar(v.Type().Elem())
-	if !isStruct && !isSc {
-		return fmt.Errorf("only scalars and structs are implemented")
+// KeyBy sets the column used as the key when scanning into a map with Into().
+func (s *SelectQuery) KeyBy(column string) *SelectQuery {
+	cl := *s
+	cl.key = column
+	return &cl
+}
+
+func (s *SelectQuery) selectMap(v reflect.Value, arg Args, mode ScanMode) error {
+	key, err := s.q.mapKey(v, s.key)
+	if err != nil {
+		return err
 	}
 
-	rows, cols, err := s.execute(arg)
+	rows, cols, err := s.execute(context.Background(), arg)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
+	return s.q.scanMap(v, rows, cols, key, mode)
+}
 
-	scannedAny := false
-	for rows.Next() {
-		scannedAny = true
-		if isSc {
-			err = scanScalar(v, rows, cols)
-		} else if isStruct {
-			err = scanStruct(v, rows, cols)
+// mapKey returns the key column for scanning into the map v points to: the given one, or the pk column of the element type.
+func (q *Dbq) mapKey(v reflect.Value, key string) (string, error) {
+	mapType := v.Type().Elem()
+	if key == "" {
+		t := mapType.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
 		}
-		if err != nil {
-			return err
+		if t.Kind() == reflect.Struct && !isScannable(t) {
+			key = q.structMap(t).pk
 		}
 	}
-	if !scannedAny {
-		return sql.ErrNoRows
+	if key == "" {
+		return "", fmt.Errorf("cannot scan into %v: no key column; use KeyBy() or mark a field with the pk tag option", mapType)
 	}
-	return nil
+	return key, nil
 }
 
-func (s *SelectQuery) execute(arg Args) (rows *sql.Rows, cols []string, err error) {
-	q, values, err := s.q.SQL(s, arg)
-	if err != nil {
-		return
+// v: pointer to a map
+// key: the name of the key column
+func (q *Dbq) scanMap(v reflect.Value, rows *sql.Rows, cols []string, key string, mode ScanMode) error {
+	mapType := v.Type().Elem()
+	keyType, elemType := mapType.Key(), mapType.Elem()
+
+	keyPos := -1
+	for i, col := range cols {
+		if col == key {
+			keyPos = i
+			break
+		}
+	}
+	if keyPos < 0 {
+		return fmt.Errorf("cannot scan into %v: key column %s is not in the result", mapType, key)
 	}
-	rows, err = s.q.Query(q, values...)
+
+	sc, err := q.keyedRowScanner(elemType, cols, keyPos, mode)
 	if err != nil {
-		return
+		return err
 	}
-	cols, err = rows.Columns()
-	return
-}
 
-func scanScalar(v reflect.Value, rows *sql.Rows, cols []string) (err error) {
-	acceptor := v.Interface()
-	acceptors := []interface{}{acceptor}
-	//	TODO: are there cheaper dummy values? RawBytes?
-	for i := 0; i < len(cols)-1; i++ {
-		acceptors = append(acceptors, new([]byte))
+	keyOpts := q.scanOptions(mode &^ ScanNullAsZero)
+	target := v.Elem()
+	if target.IsNil() {
+		target.Set(reflect.MakeMap(mapType))
 	}
-	err = rows.Scan(acceptors...)
-	return
+
+	for rows.Next() {
+		k := reflect.New(keyType)
+		if err = scanScalar(k, rows, len(cols), keyPos, keyOpts); err != nil {
+			return err
+		}
+		acceptor := reflect.New(elemType)
+		if err = sc.scan(rows, acceptor); err != nil {
+			return err
+		}
+		target.SetMapIndex(k.Elem(), acceptor.Elem())
+	}
+	return rows.Err()
 }
 
-//	v: pointer to struct
-func scanStruct(v reflect.Value, rows *sql.Rows, cols []string) (err error) {
-	str := v.Elem()
-	strT := v.Type().Elem()
-	acceptors := make([]interface{}, len(cols))
-	for i, col := range cols {
-		acceptors[i] = mapColumnToAcceptor(col, str, strT)
+func (s *SelectQuery) selectSingleRow(v reflect.Value, arg Args, mode ScanMode, unique bool) (found bool, err error) {
+	rows, cols, err := s.execute(context.Background(), arg)
+	if err != nil {
+		return
 	}
-	err = rows.Scan(acceptors...)
-	return
+	defer rows.Close()
+	return s.q.scanSingleRow(v, rows, cols, mode, unique)
 }
 
-// TODO: work around nullable primitives
+// v: pointer to the target
+// unique: whether to fail with ErrTooManyRows if there is more than one row
+func (q *Dbq) scanSingleRow(v reflect.Value, rows *sql.Rows, cols []string, mode ScanMode, unique bool) (found bool, err error) {
+	sc, err := q.rowScanner(v.Type().Elem(), cols, mode)
+	if err != nil {
+		return
+	}
 
-// v: struct
-func mapColumnToAcceptor(col string, v reflect.Value, t reflect.Type) interface{} {
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if strings.ToLower(f.Name) == col {
-			return v.Field(i).Addr().Interface()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return
 		}
+		return false, sql.ErrNoRows
+	}
+	acceptor := v
+	if unique {
+		// scan into a copy, so that the target is left untouched if there are more rows
+		acceptor = reflect.New(v.Type().Elem())
+		acceptor.Elem().Set(v.Elem())
+	}
+	if err = sc.scan(rows, acceptor); err != nil {
+		return
+	}
+	if unique && rows.Next() {
+		return false, ErrTooManyRows
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	v.Elem().Set(acceptor.Elem())
+	return true, nil
+}
+
+func (s *SelectQuery) execute(ctx context.Context, arg Args) (rows *sql.Rows, cols []string, err error) {
+	q, values, err := s.q.SQL(s, arg)
+	if err != nil {
+		return
+	}
+	rows, err = s.q.QueryContext(ctx, q, values...)
+	if err != nil {
+		return
 	}
-	return new([]byte)
+	cols, err = rows.Columns()
+	if err != nil {
+		rows.Close()
+	}
+	return
 }
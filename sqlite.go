@@ -0,0 +1,108 @@
+package dbq
+
+import (
+	"fmt"
+)
+
+/*
+SQLiteDialect generates SQL for SQLite 3.
+
+Placeholders are numbered (?1, ?2, ...), so a binding that occurs several times in a query is passed only once, as with PostgresDialect.
+Some features depend on the version of SQLite: UPSERT (ON CONFLICT) requires 3.24, window functions 3.25, RETURNING 3.35, and RIGHT and FULL OUTER JOIN and IS DISTINCT FROM 3.39.
+*/
+type SQLiteDialect struct {
+	DialectOptions
+	// Version is the version of SQLite in the format of sqlite3_libversion_number(), e.g. 3035000 for 3.35.0.
+	// Features that are newer fail to serialize, or are emulated; 0 means a version that has all of them.
+	Version int
+}
+
+func (d SQLiteDialect) SQL(e Expression, v Args) (string, []interface{}, error) {
+	return d.dialect().SQL(e, v)
+}
+
+func (d SQLiteDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.dialect().Compile(e, v)
+}
+
+func (d SQLiteDialect) SQLString(e Expression) (string, error) {
+	return d.dialect().SQLString(e)
+}
+
+func (d SQLiteDialect) Capabilities() Capability {
+	return SQLiteSyntax{Version: d.Version}.Capabilities()
+}
+
+func (d SQLiteDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.dialect().Interpolate(e, v, convert)
+}
+
+func (d SQLiteDialect) Ctx() *SQLiteCtx {
+	c := &SQLiteCtx{BaseCtx{Syntax: SQLiteSyntax{Version: d.Version}, Pretty: d.Pretty}}
+	c.Self = c
+	return c
+}
+
+// dialect returns the ctxDialect that does the work of d.
+func (d SQLiteDialect) dialect() ctxDialect {
+	return ctxDialect{ctx: func() *BaseCtx { return &d.Ctx().BaseCtx }, DialectOptions: d.DialectOptions}
+}
+
+type SQLiteCtx struct {
+	BaseCtx
+}
+
+// Insert works around the limits of UPSERT in SQLite: DO UPDATE needs a conflict target before 3.35,
+// and INSERT ... SELECT needs a WHERE clause, so that ON CONFLICT is not read as the condition of a join.
+func (c *SQLiteCtx) Insert(s *InsertExpr) (string, error) {
+	if !s.onConflict {
+		return c.BaseCtx.Insert(s)
+	}
+	if len(s.conflictTarget) == 0 && len(s.conflictColumns) > 0 && !c.Syntax.Capabilities().Has(CapReturning) {
+		// RETURNING came with the same release
+		return "", fmt.Errorf("ON CONFLICT DO UPDATE needs a conflict target before SQLite 3.35")
+	}
+	if query, ok := unwrap(s.query).(*SelectExpr); ok && len(query.tables) > 0 && len(query.conditions) == 0 {
+		cl := *s
+		cl.query = query.Where(Literal(1))
+		return c.BaseCtx.Insert(&cl)
+	}
+	return c.BaseCtx.Insert(s)
+}
+
+// SQLiteSyntax is the Syntax of SQLiteDialect: numbered ?NNN placeholders.
+type SQLiteSyntax struct {
+	DefaultSyntax
+	Version int // as in SQLiteDialect
+}
+
+func (SQLiteSyntax) Placeholder(n int) string { return fmt.Sprintf("?%d", n) }
+func (SQLiteSyntax) Positional() bool         { return false }
+
+func (s SQLiteSyntax) Capabilities() Capability {
+	caps := CapReturning | CapOnConflict | CapFullJoin | CapDistinctFrom | CapWindowFunctions
+	if s.Version == 0 {
+		return caps
+	}
+	if s.Version < 3039000 {
+		caps &^= CapFullJoin | CapDistinctFrom
+	}
+	if s.Version < 3035000 {
+		caps &^= CapReturning
+	}
+	if s.Version < 3025000 {
+		caps &^= CapWindowFunctions
+	}
+	if s.Version < 3024000 {
+		caps &^= CapOnConflict
+	}
+	return caps
+}
+
+func (s SQLiteSyntax) Limit(limit, offset uint, ordered bool) string {
+	if offset > 0 && limit == 0 {
+		// OFFSET is only allowed after LIMIT; a negative limit means none
+		return fmt.Sprintf("LIMIT -1 OFFSET %d", offset)
+	}
+	return s.DefaultSyntax.Limit(limit, offset, ordered)
+}
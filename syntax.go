@@ -0,0 +1,161 @@
+package dbq
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Syntax describes how a dialect spells the constructs that differ between databases. It is used by BaseCtx.
+
+Implementations should embed DefaultSyntax, or the Syntax of a similar dialect, and override only what differs:
+
+	type CockroachSyntax struct {
+		dbq.PostgresSyntax
+	}
+
+	func (CockroachSyntax) Cast(sql, typ string) string { ... }
+
+Methods may be added to Syntax in the future, with defaults in DefaultSyntax.
+*/
+type Syntax interface {
+	Placeholder(n int) string // the placeholder for the nth value, counting from 1
+	Positional() bool         // whether placeholders are bound by position, so that a binding needs new ones every time it occurs
+	Quote(ident string) string
+	Cast(sql, typ string) string
+	Boolean(b bool) string
+	Top(limit, offset uint) string                 // a row limit between SELECT and the column list; 0 means unset
+	Limit(limit, offset uint, ordered bool) string // the row limit clauses at the end of the query; 0 means unset
+	JoinKeyword(kind JoinKind) (string, error)
+	Capabilities() Capability
+	Literal(value interface{}) (string, error) // value written as a literal, for Interpolate()
+}
+
+// DefaultSyntax follows standard SQL where databases agree on it, and common practice where they don't: positional ? placeholders, double-quoted identifiers, CAST(), TRUE/FALSE, and LIMIT/OFFSET.
+// It claims only the capabilities that most databases have: FULL JOIN and window functions.
+type DefaultSyntax struct{}
+
+func (DefaultSyntax) Capabilities() Capability { return CapFullJoin | CapWindowFunctions }
+
+func (DefaultSyntax) Placeholder(int) string { return "?" }
+func (DefaultSyntax) Positional() bool       { return true }
+
+func (DefaultSyntax) Quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (DefaultSyntax) Cast(sql, typ string) string {
+	return "CAST(" + sql + " AS " + typ + ")"
+}
+
+func (DefaultSyntax) Boolean(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (DefaultSyntax) Top(limit, offset uint) string { return "" }
+
+func (DefaultSyntax) Limit(limit, offset uint, ordered bool) string {
+	clauses := []string{}
+	if limit > 0 {
+		clauses = append(clauses, fmt.Sprintf("LIMIT %d", limit))
+	}
+	if offset > 0 {
+		clauses = append(clauses, fmt.Sprintf("OFFSET %d", offset))
+	}
+	return strings.Join(clauses, " ")
+}
+
+func (DefaultSyntax) JoinKeyword(kind JoinKind) (string, error) {
+	switch kind {
+	case InnerJoinKind:
+		return "INNER JOIN", nil
+	case LeftJoinKind:
+		return "LEFT JOIN", nil
+	case RightJoinKind:
+		return "RIGHT JOIN", nil
+	case OuterJoinKind:
+		return "FULL OUTER JOIN", nil
+	case CrossJoinKind:
+		return "CROSS JOIN", nil
+	}
+	return "", fmt.Errorf("unknown join kind %d", kind)
+}
+
+// DialectOptions are the settings of SyntaxDialect and the built-in dialects.
+type DialectOptions struct {
+	// RejectUnusedArgs makes SQL() fail with a *BindingError when Args contains keys that the query does not reference.
+	RejectUnusedArgs bool
+	// Pretty makes the dialect write each clause of a query on its own line, and indent subqueries, for logging and golden tests.
+	Pretty bool
+}
+
+/*
+SyntaxDialect is a Dialect that serializes queries with a BaseCtx using the given Syntax:
+
+	q := NewQ(db, SyntaxDialect{Syntax: CockroachSyntax{}})
+
+The built-in dialects are SyntaxDialects with their own Syntax, and a Ctx type where they need to override more than the Syntax.
+*/
+type SyntaxDialect struct {
+	Syntax Syntax
+	DialectOptions
+}
+
+func (d SyntaxDialect) SQL(e Expression, v Args) (sql string, values []interface{}, err error) {
+	return d.dialect().SQL(e, v)
+}
+
+func (d SyntaxDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.dialect().Compile(e, v)
+}
+
+// SQLString serializes an Expression without any Args. Bindings are rendered as single placeholders.
+func (d SyntaxDialect) SQLString(e Expression) (string, error) {
+	return d.dialect().SQLString(e)
+}
+
+func (d SyntaxDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.dialect().Interpolate(e, v, convert)
+}
+
+func (d SyntaxDialect) Capabilities() Capability {
+	return d.Syntax.Capabilities()
+}
+
+func (d SyntaxDialect) Ctx() *BaseCtx {
+	return &BaseCtx{Syntax: d.Syntax, Pretty: d.Pretty}
+}
+
+func (d SyntaxDialect) dialect() ctxDialect {
+	return ctxDialect{ctx: d.Ctx, DialectOptions: d.DialectOptions}
+}
+
+// ctxDialect does the work of SyntaxDialect and the built-in dialects with the Ctx that ctx creates.
+// It is not kept in a Dbq, whose dialect must not contain funcs to be fingerprinted for the template cache.
+type ctxDialect struct {
+	ctx func() *BaseCtx
+	DialectOptions
+}
+
+func (d ctxDialect) SQL(e Expression, v Args) (sql string, values []interface{}, err error) {
+	t, err := d.Compile(e, v)
+	if err != nil {
+		return "", nil, err
+	}
+	return t.SQL, t.Bind(v), nil
+}
+
+func (d ctxDialect) Compile(e Expression, v Args) (*Template, error) {
+	return d.ctx().Compile(e, v, d.RejectUnusedArgs)
+}
+
+func (d ctxDialect) SQLString(e Expression) (string, error) {
+	return d.ctx().SQLString(e)
+}
+
+func (d ctxDialect) Interpolate(e Expression, v Args, convert func(interface{}) (interface{}, error)) (string, error) {
+	return d.ctx().Interpolate(e, v, convert)
+}
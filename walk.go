@@ -0,0 +1,366 @@
+package dbq
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Walk traverses the syntax tree rooted at n in depth-first order. It calls fn for each node, and visits the children of the node only if fn returns true:
+
+	Walk(query, func(n Node) bool {
+		if s, ok := n.(*SelectExpr); ok && len(s.Columns()) == 0 {
+			problems = append(problems, "SELECT * is not allowed")
+		}
+		return true
+	})
+
+The wrappers *Expr, *IdentExpr and the query types such as *SelectQuery are not passed to fn, only the nodes they wrap, so that fn sees *BinaryOp, *SelectExpr, Identifier, and so on.
+The table of a *ColumnExpr is passed to fn as a TableName, which has no children.
+*/
+func Walk(n Node, fn func(Node) bool) {
+	n = unwrap(n)
+	if n == nil || !fn(n) {
+		return
+	}
+	mapChildren(n, func(child Node) Node {
+		Walk(child, fn)
+		return child
+	})
+}
+
+/*
+Rewrite returns a copy of the syntax tree rooted at n in which every node has been replaced with the result of fn.
+The tree is rewritten bottom-up: fn receives a node whose children have already been rewritten, and returns it unchanged or a replacement, which is not traversed again.
+
+	scoped := Rewrite(query, func(n Node) Node {
+		if s, ok := n.(*SelectExpr); ok {
+			return s.Where(Ident("tenant_id").Eq(Bind("tenant")))
+		}
+		return n
+	})
+
+fn sees the same nodes as with Walk(). Replacements can be created with the usual constructors, such as Ident() or Binary(); fn must not return nil.
+To move a column to another table, fn can replace its TableName with another TableName or with a Tabular.
+The original tree is not modified, and the parts that fn leaves unchanged are shared with it. If n is a query such as *SelectQuery or *UpdateQuery, so is the result, as long as fn keeps the kind of statement, and it is still bound to the same *Dbq.
+*/
+func Rewrite(n Node, fn func(Node) Node) Node {
+	inner := unwrap(n)
+	if inner == nil {
+		return n
+	}
+	rewritten := fn(mapChildren(inner, func(child Node) Node {
+		return Rewrite(child, fn)
+	}))
+	if rewritten == nil {
+		panic(fmt.Errorf("cannot replace %v [%v] with nil", inner, reflect.TypeOf(inner)))
+	}
+	if sameNode(rewritten, inner) {
+		return n
+	}
+	switch s := n.(type) {
+	case *SelectQuery:
+		if ex, ok := rewritten.(*SelectExpr); ok {
+			cl := *s
+			cl.Expr = Expr{Node: ex}
+			return &cl
+		}
+	case *InsertQuery:
+		if ex, ok := rewritten.(*InsertExpr); ok {
+			cl := *s
+			cl.Expr = Expr{Node: ex}
+			return &cl
+		}
+	case *UpdateQuery:
+		if ex, ok := rewritten.(*UpdateExpr); ok {
+			cl := *s
+			cl.Expr = Expr{Node: ex}
+			return &cl
+		}
+	case *DeleteQuery:
+		if ex, ok := rewritten.(*DeleteExpr); ok {
+			cl := *s
+			cl.Expr = Expr{Node: ex}
+			return &cl
+		}
+	}
+	if _, ok := n.(Expression); ok {
+		return asExpression(rewritten)
+	}
+	return rewritten
+}
+
+// Rewrite is Rewrite() for a query.
+func (s *SelectQuery) Rewrite(fn func(Node) Node) *SelectQuery {
+	switch rewritten := Rewrite(s, fn).(type) {
+	case *SelectQuery:
+		return rewritten
+	default:
+		panic(fmt.Errorf("cannot use %v [%v] as a query", rewritten, reflect.TypeOf(rewritten)))
+	}
+}
+
+// TableName is the table of a *ColumnExpr, as Walk() and Rewrite() pass it to their callback. It tells a table apart from the identifiers of the query, which are plain Identifiers.
+type TableName struct {
+	Table Tabular
+}
+
+func (TableName) IsCompound() bool               { return false }
+func (t TableName) String(c Ctx) (string, error) { return Identifier(t.Table.Name()).String(c) }
+
+// unwrap returns the node that a generic wrapper stands for.
+func unwrap(n Node) Node {
+	for {
+		switch w := n.(type) {
+		case *Expr:
+			n = w.Node
+		case *IdentExpr:
+			n = w.Node
+		case *SelectQuery:
+			n = w.Expr.Node
+		case *InsertQuery:
+			n = w.Expr.Node
+		case *UpdateQuery:
+			n = w.Expr.Node
+		case *DeleteQuery:
+			n = w.Expr.Node
+		default:
+			return n
+		}
+	}
+}
+
+// sameNode reports whether a and b are the same node. Nodes of types that cannot be compared are never the same.
+func sameNode(a, b Node) bool {
+	t := reflect.TypeOf(a)
+	return t != nil && t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// asExpression wraps a node returned by a rewrite function as an Expression, as its constructor would.
+func asExpression(n Node) Expression {
+	switch n := n.(type) {
+	case Expression:
+		return n
+	case Identifier:
+		return &IdentExpr{Expr{n}}
+	}
+	return &Expr{n}
+}
+
+// childMapper applies f to the children of a node, and records whether any of them were replaced.
+type childMapper struct {
+	f       func(Node) Node
+	changed bool
+}
+
+func (m *childMapper) node(n Node) Node {
+	if n == nil {
+		return nil
+	}
+	r := m.f(n)
+	if !sameNode(r, n) {
+		m.changed = true
+	}
+	return r
+}
+
+func (m *childMapper) expr(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	return asExpression(m.node(e))
+}
+
+func (m *childMapper) table(t Tabular) Tabular {
+	switch r := m.node(TableName{t}).(type) {
+	case TableName:
+		return r.Table
+	case Tabular:
+		return r
+	case Identifier, QuotedIdentifier, QualifiedName:
+		return ident(r)
+	default:
+		panic(fmt.Errorf("cannot use %v [%v] as a table", r, reflect.TypeOf(r)))
+	}
+}
+
+func (m *childMapper) order(o *OrderExpr) *OrderExpr {
+	if o == nil {
+		return nil
+	}
+	switch r := unwrap(m.node(o)).(type) {
+	case *OrderExpr:
+		return r
+	default:
+		panic(fmt.Errorf("cannot use %v [%v] as an order clause", r, reflect.TypeOf(r)))
+	}
+}
+
+// exprs maps a list of expressions. The list is only copied if an element changes.
+func (m *childMapper) exprs(es []Expression) []Expression {
+	var out []Expression
+	for i, e := range es {
+		r := m.expr(e)
+		if out == nil && !sameNode(r, e) {
+			out = append(make([]Expression, 0, len(es)), es[:i]...)
+		}
+		if out != nil {
+			out = append(out, r)
+		}
+	}
+	if out == nil {
+		return es
+	}
+	return out
+}
+
+// nodes maps a list of nodes. The list is only copied if an element changes.
+func (m *childMapper) nodes(ns []Node) []Node {
+	var out []Node
+	for i, n := range ns {
+		r := m.node(n)
+		if out == nil && !sameNode(r, n) {
+			out = append(make([]Node, 0, len(ns)), ns[:i]...)
+		}
+		if out != nil {
+			out = append(out, r)
+		}
+	}
+	if out == nil {
+		return ns
+	}
+	return out
+}
+
+// mapChildren calls f for each child of n, and returns a copy of n with the children replaced by the results, or n itself if f did not change any of them.
+// Nodes of types that dbq does not know are treated as leaves.
+func mapChildren(n Node, f func(Node) Node) Node {
+	m := &childMapper{f: f}
+	switch n := n.(type) {
+	case *AliasExpr:
+		source := m.node(n.Source)
+		if m.changed {
+			return &AliasExpr{Expression: n.Expression, Source: source}
+		}
+	case *BinaryOp:
+		a, b := m.expr(n.a), m.expr(n.b)
+		if m.changed {
+			return &BinaryOp{a: a, b: b, op: n.op}
+		}
+	case *InExpr:
+		element, list := m.expr(n.element), m.expr(n.list)
+		if m.changed {
+			return &InExpr{element: element, list: list, not: n.not}
+		}
+	case *ColumnExpr:
+		table := m.table(n.table)
+		if m.changed {
+			return &ColumnExpr{table: table, column: n.column}
+		}
+	case exprList:
+		if es := m.exprs(n); m.changed {
+			return exprList(es)
+		}
+	case *CastExpr:
+		e := m.expr(n.e)
+		if m.changed {
+			return &CastExpr{e: e, typ: n.typ}
+		}
+	case *FuncExpr:
+		values := m.exprs(n.values)
+		if m.changed {
+			return &FuncExpr{name: n.name, values: values}
+		}
+	case *AggFuncExpr:
+		values, order := m.exprs(n.values), m.node(n.order)
+		if m.changed {
+			cl := *n
+			cl.values, cl.order = values, order
+			return &cl
+		}
+	case *OrderExpr:
+		var clauses []OrderClause
+		for i, clause := range n.exprs {
+			column := m.expr(clause.column)
+			if clauses == nil && m.changed {
+				clauses = append(make([]OrderClause, 0, len(n.exprs)), n.exprs[:i]...)
+			}
+			if clauses != nil {
+				clauses = append(clauses, OrderClause{column: column, order: clause.order})
+			}
+		}
+		if m.changed {
+			return &OrderExpr{exprs: clauses}
+		}
+	case *WindowExpr:
+		fn, partition, order := m.expr(n.fn), m.exprs(n.partition), m.order(n.order)
+		if m.changed {
+			return &WindowExpr{fn: fn, partition: partition, order: order}
+		}
+	case *SelectExpr:
+		cl := *n
+		cl.distinctOn = m.exprs(n.distinctOn)
+		cl.columns = m.nodes(n.columns)
+		cl.tables = m.nodes(n.tables)
+		cl.conditions = m.exprs(n.conditions)
+		cl.group = m.exprs(n.group)
+		cl.order = m.node(n.order)
+		if m.changed {
+			return &cl
+		}
+	case *InsertExpr:
+		cl := *n
+		cl.table = m.node(n.table)
+		cl.columns = m.exprs(n.columns)
+		var rows [][]Expression
+		for i, row := range n.rows {
+			mapped := m.exprs(row)
+			if rows == nil && m.changed {
+				rows = append(make([][]Expression, 0, len(n.rows)), n.rows[:i]...)
+			}
+			if rows != nil {
+				rows = append(rows, mapped)
+			}
+		}
+		if rows != nil {
+			cl.rows = rows
+		}
+		cl.query = m.node(n.query)
+		cl.conflictTarget = m.exprs(n.conflictTarget)
+		cl.conflictColumns = m.exprs(n.conflictColumns)
+		cl.conflictValues = m.exprs(n.conflictValues)
+		cl.returning = m.exprs(n.returning)
+		if m.changed {
+			return &cl
+		}
+	case *UpdateExpr:
+		cl := *n
+		cl.table = m.node(n.table)
+		cl.columns = m.exprs(n.columns)
+		cl.values = m.exprs(n.values)
+		cl.conditions = m.exprs(n.conditions)
+		cl.returning = m.exprs(n.returning)
+		if m.changed {
+			return &cl
+		}
+	case *DeleteExpr:
+		cl := *n
+		cl.table = m.node(n.table)
+		cl.conditions = m.exprs(n.conditions)
+		cl.returning = m.exprs(n.returning)
+		if m.changed {
+			return &cl
+		}
+	case *JoinExpr:
+		table, condition := m.node(n.table), m.node(n.condition)
+		if m.changed {
+			return &JoinExpr{kind: n.kind, table: table, condition: condition}
+		}
+	case *JoinCondition:
+		condition := m.node(n.condition)
+		if m.changed {
+			return &JoinCondition{kind: n.kind, condition: condition}
+		}
+	}
+	return n
+}